@@ -0,0 +1,61 @@
+// Package reader reads the xkcd index files directly, without importing
+// the xkcd package or protocol buffers, so external tools can consume them.
+//
+// # Files
+//
+// 'xkcd_index.db' and 'log.db' are BoltDB databases. Each logical index
+// (namespace) has its own buckets; the default namespace uses the bucket
+// names below and any other namespace prefixes them with its name and a
+// slash (ex: 'experimental/main').
+//
+// # DocIDs
+//
+// A DocID is the comic number, encoded as a 2 byte big-endian unsigned
+// integer. DocIDs above 65535 cannot be represented.
+//
+// # Posting lists
+//
+// Bucket 'main' of 'xkcd_index.db' is the inverted index. Each key is a
+// term. With the default tokenization rules a term is a lowercase run of
+// ASCII letters and digits, but the rules are configurable (see bucket
+// 'meta' below), and 'xkcd cluster -export' adds terms of the form
+// 'cluster:N' (ex: 'cluster:3'). Each value is the posting list of the
+// term: the DocIDs of the comics containing it, concatenated as 2 byte
+// big-endian unsigned integers in ascending order without duplicates. A
+// value's length is always even, and a term with no postings has no key.
+// Bucket 'title' has the same format, keyed by normalized title (its terms
+// joined by single spaces).
+//
+// # Records
+//
+// Bucket 'data' maps each DocID key to the comic's record: a protocol
+// buffers (proto3) encoding of the LogDataStruct message in
+// 'logData.proto', with these fields:
+//
+//	1  Month       string (ex: "3")
+//	2  Num         int32, varint
+//	3  Link        string (ex: "https://xkcd.com/327")
+//	4  Year        string (ex: "2008")
+//	5  News        string
+//	6  SafeTitle   string
+//	7  Transcript  string
+//	8  Alt         string
+//	9  Img         string
+//	10 Title       string
+//	11 Day         string (ex: "14")
+//
+// Fields with their zero value are omitted; unknown fields must be skipped.
+//
+// # Other buckets
+//
+// Bucket 'fetched' maps each DocID to the time the comic was downloaded as
+// RFC 3339 text. Bucket 'meta' key 'tokenize' holds the JSON tokenization
+// rules the terms were indexed with (absent for indexes built with the
+// default rules before they were recorded), and key 'terms' the total
+// number of terms of the comics in 'data' as decimal text. Bucket
+// 'shards', present when the year-sharded layout is enabled, holds one
+// nested bucket per publication year (ex: '2015') in the format of 'main',
+// restricted to that year's comics; its shards are up to date only while
+// its 'built' key is present. Bucket 'log' of 'log.db' holds a single key,
+// 'index', whose value is the next DocID to download, encoded as a DocID.
+package reader
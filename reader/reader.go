@@ -0,0 +1,189 @@
+package reader
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Record is a stored comic
+type Record struct {
+	Month      string
+	Num        int32
+	Link       string
+	Year       string
+	News       string
+	SafeTitle  string
+	Transcript string
+	Alt        string
+	Img        string
+	Title      string
+	Day        string
+}
+
+// Reader reads one namespace of an 'xkcd_index.db' file
+type Reader struct {
+	db        *bolt.DB
+	namespace string
+}
+
+// Open opens the index at path read-only for the default namespace
+func Open(path string) (*Reader, error) {
+	return OpenNamespace(path, "")
+}
+
+// OpenNamespace opens the index at path read-only for namespace
+// ("" or "default" for the default namespace)
+func OpenNamespace(path, namespace string) (*Reader, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true, Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	if namespace == "default" {
+		namespace = ""
+	}
+	return &Reader{db, namespace}, nil
+}
+
+// Close closes the index
+func (r *Reader) Close() error {
+	return r.db.Close()
+}
+
+// bucket returns the name of bucket name in the reader's namespace
+func (r *Reader) bucket(name string) []byte {
+	if r.namespace == "" {
+		return []byte(name)
+	}
+	return []byte(r.namespace + "/" + name)
+}
+
+// Postings returns the posting list of term, or nil if it isn't indexed
+func (r *Reader) Postings(term string) ([]int, error) {
+	var refs []int
+	err := r.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(r.bucket("main"))
+		if b == nil {
+			return errors.New("'main' bucket not found")
+		}
+		var err error
+		refs, err = DecodePostings(b.Get([]byte(term)))
+		return err
+	})
+	return refs, err
+}
+
+// Terms calls fn with each term and its posting list in term order
+func (r *Reader) Terms(fn func(term string, refs []int) error) error {
+	return r.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(r.bucket("main"))
+		if b == nil {
+			return errors.New("'main' bucket not found")
+		}
+		return b.ForEach(func(k, v []byte) error {
+			refs, err := DecodePostings(v)
+			if err != nil {
+				return fmt.Errorf("term %q: %v", k, err)
+			}
+			return fn(string(k), refs)
+		})
+	})
+}
+
+// Record returns the record of DocID id. ok is false if it isn't stored.
+func (r *Reader) Record(id int) (rec Record, ok bool, err error) {
+	err = r.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(r.bucket("data"))
+		if b == nil {
+			return errors.New("'data' bucket not found")
+		}
+		v := b.Get(EncodeDocID(id))
+		if v == nil {
+			return nil
+		}
+		ok = true
+		rec, err = DecodeRecord(v)
+		return err
+	})
+	return rec, ok, err
+}
+
+// EncodeDocID encodes a DocID as stored in keys and posting lists
+func EncodeDocID(id int) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, uint16(id))
+	return b
+}
+
+// DecodeDocID decodes a stored DocID
+func DecodeDocID(b []byte) (int, error) {
+	if len(b) != 2 {
+		return 0, fmt.Errorf("DocID is %d bytes, want 2", len(b))
+	}
+	return int(binary.BigEndian.Uint16(b)), nil
+}
+
+// DecodePostings decodes a stored posting list
+func DecodePostings(b []byte) ([]int, error) {
+	if len(b)%2 != 0 {
+		return nil, fmt.Errorf("posting list is %d bytes, want an even length", len(b))
+	}
+	refs := make([]int, 0, len(b)/2)
+	for i := 0; i < len(b); i += 2 {
+		refs = append(refs, int(binary.BigEndian.Uint16(b[i:])))
+	}
+	return refs, nil
+}
+
+// DecodeRecord decodes a stored record from its protocol buffers encoding
+func DecodeRecord(b []byte) (Record, error) {
+	var rec Record
+	strs := map[uint64]*string{
+		1: &rec.Month, 3: &rec.Link, 4: &rec.Year, 5: &rec.News, 6: &rec.SafeTitle,
+		7: &rec.Transcript, 8: &rec.Alt, 9: &rec.Img, 10: &rec.Title, 11: &rec.Day,
+	}
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return rec, errors.New("malformed field key")
+		}
+		b = b[n:]
+		field, wire := key>>3, key&7
+		switch wire {
+		case 0: // varint
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return rec, fmt.Errorf("field %d: malformed varint", field)
+			}
+			b = b[n:]
+			if field == 2 {
+				rec.Num = int32(v)
+			}
+		case 2: // length-delimited
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return rec, fmt.Errorf("field %d: malformed length", field)
+			}
+			if s, ok := strs[field]; ok {
+				*s = string(b[n : n+int(l)])
+			}
+			b = b[n+int(l):]
+		case 1: // 64-bit
+			if len(b) < 8 {
+				return rec, fmt.Errorf("field %d: truncated", field)
+			}
+			b = b[8:]
+		case 5: // 32-bit
+			if len(b) < 4 {
+				return rec, fmt.Errorf("field %d: truncated", field)
+			}
+			b = b[4:]
+		default:
+			return rec, fmt.Errorf("field %d: unsupported wire type %d", field, wire)
+		}
+	}
+	return rec, nil
+}
@@ -0,0 +1,56 @@
+package xkcd
+
+import (
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+// maxAbsent is the number of absent terms kept in the 'absent' bucket;
+// the bucket is emptied when it is full
+const maxAbsent = 1000
+
+// AbsentTerms returns the terms of q recorded in the 'absent' bucket as
+// having no postings, so searches can skip reading them
+func AbsentTerms(tx *bolt.Tx, q []string) map[string]bool {
+	absent := make(map[string]bool)
+	b := tx.Bucket(Bucket("absent"))
+	if b == nil {
+		return absent
+	}
+	for _, term := range q {
+		if b.Get([]byte(term)) != nil {
+			absent[term] = true
+		}
+	}
+	return absent
+}
+
+// RecordAbsent records terms as having no postings in the 'absent'
+// bucket. InvalidateCache deletes the bucket whenever the index changes.
+func RecordAbsent(tx *bolt.Tx, terms []string) error {
+	if len(terms) == 0 {
+		return nil
+	}
+	b, err := tx.CreateBucketIfNotExists(Bucket("absent"))
+	if err != nil {
+		return fmt.Errorf("create 'absent' bucket failed:\n%s", err)
+	}
+	if b.Stats().KeyN+len(terms) > maxAbsent {
+		if err := tx.DeleteBucket(Bucket("absent")); err != nil {
+			return fmt.Errorf("delete 'absent' bucket failed:\n%s", err)
+		}
+		if b, err = tx.CreateBucket(Bucket("absent")); err != nil {
+			return fmt.Errorf("create 'absent' bucket failed:\n%s", err)
+		}
+	}
+	for _, term := range terms {
+		if term == "" {
+			continue
+		}
+		if err := b.Put([]byte(term), []byte{}); err != nil {
+			return fmt.Errorf("put failed:\n%s", err)
+		}
+	}
+	return nil
+}
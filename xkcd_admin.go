@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// job is a background update or reindex started from the admin endpoints
+type job struct {
+	ID       string     `json:"id"`
+	Kind     string     `json:"kind"`
+	Index    string     `json:"index"`  // namespace the job runs in
+	Status   string     `json:"status"` // running, done or failed
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Result   string     `json:"result,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// admin wraps an admin endpoint, requiring 'Authorization: Bearer <token>'
+func (p *proxy) admin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if p.token == "" {
+			http.Error(w, "admin endpoints disabled - start the proxy with -token", http.StatusForbidden)
+			return
+		}
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(p.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// jobRetention is how long finished jobs can be polled before they're
+// forgotten
+const jobRetention = time.Hour
+
+// jobKinds are the jobs the admin endpoints and schedules can start, each
+// returning a summary of its result
+var jobKinds = map[string]func() (string, error){
+	"update":  runUpdateJob,
+	"reindex": runReindexJob,
+}
+
+// startJob returns the handler starting a background job of kind in the
+// request's namespace
+func (p *proxy) startJob(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		resp := p.runJob(kind, tenant(r))
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/admin/jobs/"+resp.ID)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// runJob starts a background job of kind in namespace ns and returns a
+// copy of the job. The package's state (namespace, update counters) is
+// global, so each job runs as an 'xkcd job' child process with the
+// proxy's global flags and the namespace's data directory, and requests
+// are served while it runs. Jobs of the same namespace run one at a time.
+func (p *proxy) runJob(kind, ns string) job {
+	p.jobsMu.Lock()
+	p.lastJob++
+	j := &job{ID: strconv.Itoa(p.lastJob), Kind: kind, Index: ns, Status: "running", Started: time.Now()}
+	p.pruneJobs(j.Started)
+	p.jobs[j.ID] = j
+	resp := *j
+	lock := p.nsJobs[ns]
+	if lock == nil {
+		lock = new(sync.Mutex)
+		p.nsJobs[ns] = lock
+	}
+	p.jobsMu.Unlock()
+
+	go func() {
+		lock.Lock()
+		result, err := p.execJob(kind, ns)
+		lock.Unlock()
+
+		p.jobsMu.Lock()
+		defer p.jobsMu.Unlock()
+		now := time.Now()
+		j.Finished, j.Result, j.Status = &now, result, "done"
+		if err != nil {
+			j.Status, j.Error = "failed", err.Error()
+			log.Printf("%s job %s (%s) failed: %v", kind, j.ID, ns, err)
+		}
+	}()
+	return resp
+}
+
+// pruneJobs forgets the jobs finished more than 'jobRetention' before
+// now. p.jobsMu must be held.
+func (p *proxy) pruneJobs(now time.Time) {
+	for id, j := range p.jobs {
+		if j.Finished != nil && now.Sub(*j.Finished) > jobRetention {
+			delete(p.jobs, id)
+		}
+	}
+}
+
+// execJob runs a job of kind in namespace ns in a child process, echoing
+// its output, and returns the last line it printed, its result
+func (p *proxy) execJob(kind, ns string) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	args := append(append([]string(nil), p.args...), "-datadir", p.tenants[ns], "-index", ns, "job", kind)
+	var stdout, stderr bytes.Buffer
+	c := exec.Command(exe, args...)
+	c.Stdout = io.MultiWriter(os.Stdout, &stdout)
+	c.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	if err := c.Run(); err != nil {
+		if msg := lastLine(stderr.String()); msg != "" {
+			return "", errors.New(msg)
+		}
+		return "", err
+	}
+	return lastLine(stdout.String()), nil
+}
+
+// lastLine returns the last non-empty line of s
+func lastLine(s string) string {
+	s = strings.TrimRight(s, "\n")
+	return s[strings.LastIndex(s, "\n")+1:]
+}
+
+// jobCommand runs a job of the kind named by args[0] and prints its
+// result last ('xkcd -index whatif job update'); the proxy runs jobs this
+// way
+func jobCommand(args []string) error {
+	if len(args) != 1 || jobKinds[args[0]] == nil {
+		return usageErrorf("usage: xkcd job update|reindex")
+	}
+	result, err := jobKinds[args[0]]()
+	if err != nil {
+		return err
+	}
+	fmt.Println(result)
+	return nil
+}
+
+// serveJob serves the status of the job at '/admin/jobs/<id>'
+func (p *proxy) serveJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p.jobsMu.Lock()
+	j, ok := p.jobs[strings.TrimPrefix(r.URL.Path, "/admin/jobs/")]
+	ok = ok && j.Index == tenant(r) // jobs are only visible to their namespace
+	var resp job
+	if ok {
+		resp = *j
+	}
+	p.jobsMu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// runUpdateJob indexes the comics published since the last update
+func runUpdateJob() (string, error) {
+	if err := requireNetwork("update"); err != nil {
+		return "", err
+	}
+	added, err := xkcd.Update()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("comics added: %v", len(added)), nil
+}
+
+// runReindexJob rebuilds the inverted index from the stored comics
+func runReindexJob() (string, error) {
+	comics, terms, err := xkcd.Reindex()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("comics reindexed: %v, terms: %v", comics, terms), nil
+}
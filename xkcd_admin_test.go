@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPruneJobs(t *testing.T) {
+	now := time.Now()
+	old, recent := now.Add(-2*jobRetention), now.Add(-time.Minute)
+	p := &proxy{jobs: map[string]*job{
+		"1": {ID: "1", Status: "done", Finished: &old},
+		"2": {ID: "2", Status: "failed", Finished: &recent},
+		"3": {ID: "3", Status: "running", Started: old},
+	}}
+	p.pruneJobs(now)
+	if _, ok := p.jobs["1"]; ok {
+		t.Error("job finished before the retention period was kept")
+	}
+	for _, id := range []string{"2", "3"} {
+		if _, ok := p.jobs[id]; !ok {
+			t.Errorf("job %s was pruned", id)
+		}
+	}
+}
+
+func TestLastLine(t *testing.T) {
+	for _, c := range []struct{ in, want string }{
+		{"", ""},
+		{"comics added: 3\n", "comics added: 3"},
+		{"log.db found\ncomics added: 3\n\n", "comics added: 3"},
+	} {
+		if got := lastLine(c.in); got != c.want {
+			t.Errorf("lastLine(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
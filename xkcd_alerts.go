@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// alert is a saved search evaluated against each new comic in watch mode
+type alert struct {
+	Name    string `json:"name"`
+	Query   string `json:"query"`
+	Webhook string `json:"webhook,omitempty"` // URL new matches are POSTed to as JSON
+	Desktop bool   `json:"desktop,omitempty"` // show a desktop notification with notify-send
+}
+
+// alertCommand adds, lists or removes saved search alerts
+// ('xkcd alerts add -webhook https://example.com/hook physics laser',
+// 'xkcd alerts list', 'xkcd alerts rm physics')
+func alertCommand(args []string) error {
+	usage := usageErrorf("usage: xkcd alerts add [-webhook <url>] [-desktop] <name> <query>... | list | rm <name>")
+	if len(args) == 0 {
+		return usage
+	}
+	switch args[0] {
+	case "add":
+		fs := flag.NewFlagSet("alerts add", flag.ExitOnError)
+		webhook := fs.String("webhook", "", "POST matching comics as JSON to `url`")
+		desktop := fs.Bool("desktop", false, "show a desktop notification for matching comics")
+		pos := parseArgs(fs, args[1:])
+		if len(pos) < 2 {
+			return usage
+		}
+		a := alert{Name: pos[0], Query: strings.Join(pos[1:], " "), Webhook: *webhook, Desktop: *desktop}
+		return saveAlert(a)
+	case "list":
+		alerts, err := readAlerts()
+		if err != nil {
+			return err
+		}
+		for _, a := range alerts {
+			fmt.Printf("%s\t%s", a.Name, a.Query)
+			if a.Webhook != "" {
+				fmt.Printf("\twebhook: %s", a.Webhook)
+			}
+			if a.Desktop {
+				fmt.Print("\tdesktop")
+			}
+			fmt.Println()
+		}
+		return nil
+	case "rm":
+		if len(args) != 2 {
+			return usage
+		}
+		return deleteAlert(args[1])
+	default:
+		return usage
+	}
+}
+
+// saveAlert stores a in the 'alerts' bucket, replacing any alert of the same name
+func saveAlert(a alert) error {
+	v, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("JSON marshalling failed: %s", err)
+	}
+	db, err := openIndex(true)
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+	t := xkcd.TraceTx("update", "alerts")
+	uErr := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(xkcd.Bucket("alerts"))
+		if err != nil {
+			return fmt.Errorf("create 'alerts' bucket failed:\n%s", err)
+		}
+		t.Put([]byte(a.Name), v)
+		return b.Put([]byte(a.Name), v)
+	})
+	t.Done(uErr)
+	if uErr != nil {
+		return fmt.Errorf("update transaction failed:\n%w", uErr)
+	}
+	return nil
+}
+
+// deleteAlert removes the alert called name
+func deleteAlert(name string) error {
+	db, err := openIndex(true)
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+	t := xkcd.TraceTx("update", "alerts")
+	uErr := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(xkcd.Bucket("alerts"))
+		if b == nil || b.Get([]byte(name)) == nil {
+			return fmt.Errorf("no alert named %q", name)
+		}
+		t.Delete()
+		return b.Delete([]byte(name))
+	})
+	t.Done(uErr)
+	if uErr != nil {
+		return fmt.Errorf("update transaction failed:\n%w", uErr)
+	}
+	return nil
+}
+
+// readAlerts returns every saved alert
+func readAlerts() ([]alert, error) {
+	if err := checkIndex(); err != nil {
+		return nil, err
+	}
+	db, err := openIndex(false)
+	if err != nil {
+		return nil, fmt.Errorf("db failed to open:\n%s", err)
+	}
+	var alerts []alert
+	t := xkcd.TraceTx("view", "alerts")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(xkcd.Bucket("alerts"))
+		if b == nil {
+			return nil // no alerts saved yet
+		}
+		return b.ForEach(func(k, v []byte) error {
+			t.Get()
+			var a alert
+			if err := json.Unmarshal(v, &a); err != nil {
+				return fmt.Errorf("JSON unmarshalling failed: %s", err)
+			}
+			alerts = append(alerts, a)
+			return nil
+		})
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		return nil, fmt.Errorf("view op failed: %w", vErr)
+	}
+	return alerts, nil
+}
+
+// matches reports whether comic d contains every term of the alert's query
+func (a alert) matches(d xkcd.LogData) bool {
+	terms := make(map[string]bool)
+	for _, t := range xkcd.DocTerms(d) {
+		terms[t] = true
+	}
+	query := xkcd.Tokenize(a.Query)
+	for _, t := range query {
+		if !terms[t] {
+			return false
+		}
+	}
+	return len(query) > 0
+}
+
+// fire sends each of the alert's notifications for comic d
+func (a alert) fire(d xkcd.LogData) error {
+	fmt.Printf("alert '%s': %d %s - %s\n", a.Name, d.Num, d.Title, d.Link)
+	if a.Webhook != "" {
+		body, err := json.Marshal(struct {
+			Alert string      `json:"alert"`
+			Query string      `json:"query"`
+			Comic comicRecord `json:"comic"`
+		}{a.Name, a.Query, newComicRecord(d, nil)})
+		if err != nil {
+			return fmt.Errorf("JSON marshalling failed: %s", err)
+		}
+		req, err := xkcd.NewRequest(context.Background(), http.MethodPost, a.Webhook, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("invalid webhook: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if xkcd.Offline {
+			return &xkcd.NetworkError{URL: a.Webhook, Err: xkcd.ErrOffline}
+		}
+		resp, err := xkcd.Client.Do(req)
+		if err != nil {
+			return &xkcd.NetworkError{URL: a.Webhook, Err: err}
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return &xkcd.NetworkError{URL: a.Webhook, Status: resp.StatusCode, Err: fmt.Errorf("%s", resp.Status)}
+		}
+	}
+	if a.Desktop {
+		title := fmt.Sprintf("xkcd alert '%s'", a.Name)
+		if err := exec.Command("notify-send", title, fmt.Sprintf("%d: %s\n%s", d.Num, d.Title, d.Link)).Run(); err != nil {
+			return fmt.Errorf("desktop notification failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// checkAlerts fires every saved alert matching one of the new comics
+func checkAlerts(added []xkcd.LogData) error {
+	if len(added) == 0 {
+		return nil
+	}
+	alerts, err := readAlerts()
+	closeIndex() // the next update opens the database itself
+	if err != nil {
+		return err
+	}
+	for _, d := range added {
+		for _, a := range alerts {
+			if !a.matches(d) {
+				continue
+			}
+			if err := a.fire(d); err != nil {
+				fmt.Printf("alert '%s' failed: %v\n", a.Name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// altComic is a comic and the length of its alt text in characters
+type altComic struct {
+	Num    int32  `json:"num"`
+	Title  string `json:"title"`
+	Length int    `json:"length"`
+}
+
+// altStats summarizes the alt text of the stored comics
+type altStats struct {
+	Comics    int        `json:"comics"`
+	WithAlt   int        `json:"with_alt"`
+	AvgLength float64    `json:"avg_length"` // of comics with alt text
+	Longest   []altComic `json:"longest"`
+	Shortest  []altComic `json:"shortest"`
+	Missing   []altComic `json:"missing"`
+}
+
+// altTextReport prints alt text statistics: the longest and shortest
+// alt texts, their average length, and comics missing alt text
+// ('xkcd alttext -n 10 -json')
+func altTextReport(args []string) error {
+	fs := flag.NewFlagSet("alttext", flag.ExitOnError)
+	n := fs.Int("n", 5, "number of longest and shortest alt texts to list")
+	asJSON := fs.Bool("json", false, "write report as JSON")
+	fs.Parse(args)
+	if *n < 0 {
+		return usageErrorf("-n must be at least 0")
+	}
+
+	if err := checkIndex(); err != nil {
+		return err
+	}
+	db, err := openIndex(false)
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+	var stats altStats
+	var alts []altComic
+	total := 0
+	err = eachComic(db, func(d xkcd.LogData) {
+		stats.Comics++
+		c := altComic{d.Num, d.Title, utf8.RuneCountInString(strings.TrimSpace(d.Alt))}
+		if c.Length == 0 {
+			stats.Missing = append(stats.Missing, c)
+			return
+		}
+		alts = append(alts, c)
+		total += c.Length
+	})
+	if err != nil {
+		return err
+	}
+	stats.WithAlt = len(alts)
+	if len(alts) > 0 {
+		stats.AvgLength = float64(total) / float64(len(alts))
+	}
+	sort.SliceStable(alts, func(i, j int) bool { return alts[i].Length > alts[j].Length })
+	k := *n
+	if k > len(alts) {
+		k = len(alts)
+	}
+	stats.Longest = alts[:k]
+	for i := len(alts) - 1; i >= len(alts)-k; i-- {
+		stats.Shortest = append(stats.Shortest, alts[i])
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	}
+	fmt.Printf("comics: %v\n", stats.Comics)
+	fmt.Printf("with alt text: %v\n", stats.WithAlt)
+	fmt.Printf("average alt text length: %.1f chars\n", stats.AvgLength)
+	printAlts := func(heading string, cs []altComic) {
+		fmt.Printf("\n%s\n", heading)
+		for _, c := range cs {
+			fmt.Printf("%5d\t%5d chars\t%s\n", c.Num, c.Length, c.Title)
+		}
+	}
+	printAlts("longest alt text:", stats.Longest)
+	printAlts("shortest alt text:", stats.Shortest)
+	fmt.Printf("\nmissing alt text: %v\n", len(stats.Missing))
+	for _, c := range stats.Missing {
+		fmt.Printf("%5d\t%s\n", c.Num, c.Title)
+	}
+	return nil
+}
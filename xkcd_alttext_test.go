@@ -0,0 +1,9 @@
+package main
+
+import "testing"
+
+func TestAltTextReportNegativeN(t *testing.T) {
+	if got := exitCode(altTextReport([]string{"-n", "-1"})); got != exitUsage {
+		t.Errorf("exit code = %v, want %v", got, exitUsage)
+	}
+}
@@ -0,0 +1,259 @@
+package xkcd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// BackfillRetries is the number of times the retry queue re-requests a
+// comic that failed to download before the backfill is stopped
+var BackfillRetries = 3
+
+// fetchResult is the downloaded JSON info of a single comic
+type fetchResult struct {
+	Num  int
+	Info []byte
+	OK   bool // false for comics that don't exist (http 404)
+	Err  error
+}
+
+// Backfill downloads every comic after the last indexed one using up to
+// 'workers' concurrent requests. Responses are committed to the index in
+// DocID order, 'batch' comics per transaction, so an interrupted backfill
+// can resume from the last committed comic. Failed requests are retried
+// from a queue with exponential backoff, and the stored comics are
+// verified once the backfill completes.
+func Backfill(workers, batch int) error {
+	if workers < 1 || batch < 1 {
+		return fmt.Errorf("workers and batch must be at least 1")
+	}
+	GetIndex()
+	start := Index
+	latest, err := latestNum()
+	if err != nil {
+		return err
+	}
+	if start > latest {
+		fmt.Printf("index up to date: %v comics\n", latest)
+		return nil
+	}
+	defer flushFailures()
+	fmt.Printf("backfilling comics %v-%v with %v workers...\n", start, latest, workers)
+
+	results := fetchAll(start, latest, workers)
+
+	// commit responses in DocID order as they arrive
+	pending := make(map[int]fetchResult)
+	next, mapped := start, 0
+	var fetchErr error
+	for r := range results {
+		if fetchErr != nil {
+			continue // drain remaining responses
+		}
+		pending[r.Num] = r
+		for ; next <= latest; next++ {
+			if next == 404 { // skip special case - http 404 error page
+				continue
+			}
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			if r.Err != nil {
+				noteFailure(next, "backfill", r.Err)
+				fetchErr = fmt.Errorf("request failed: %w\n comics committed: %v", r.Err, next-start)
+				break
+			}
+			if !r.OK {
+				continue
+			}
+			Index, URL = next, XKCDURL+strconv.Itoa(next)
+			mapTerms(formatEntry(r.Info))
+			mapData(r.Info, next)
+			if err := writeOutput(r.Info); err != nil {
+				return fmt.Errorf("Write to %s failed:\n%v", LogFile(), err)
+			}
+			mapped++
+			if mapped%batch == 0 {
+				if err := commitBatch(next + 1); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err := commitBatch(next); err != nil {
+		return err
+	}
+	if fetchErr != nil {
+		return fetchErr
+	}
+	fmt.Printf("comics indexed: %v\n", mapped)
+	return verifyBackfill(start, latest)
+}
+
+// fetchAll downloads comics from through to concurrently and sends each
+// response on the returned channel, which is closed once every comic has
+// been downloaded or has exhausted its retries
+func fetchAll(from, to, workers int) <-chan fetchResult {
+	jobs := make(chan int, to-from+1)
+	for i := from; i <= to; i++ {
+		if i != 404 {
+			jobs <- i
+		}
+	}
+	close(jobs)
+
+	results := make(chan fetchResult, workers)
+	retry := make(chan int, to-from+1)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				info, ok, err := fetchInfo(i)
+				if err != nil {
+					retry <- i
+					continue
+				}
+				results <- fetchResult{i, info, ok, nil}
+			}
+		}()
+	}
+
+	// the retry queue re-requests failed comics one at a time so a
+	// struggling server isn't hit by every worker at once
+	go func() {
+		wg.Wait()
+		close(retry)
+	}()
+	go func() {
+		defer close(results)
+		for i := range retry {
+			var r fetchResult
+			for attempt := 0; attempt < BackfillRetries; attempt++ {
+				time.Sleep(time.Duration(1<<uint(attempt)) * time.Second)
+				info, ok, err := fetchInfo(i)
+				r = fetchResult{i, info, ok, err}
+				if err == nil {
+					break
+				}
+			}
+			results <- r
+		}
+	}()
+	return results
+}
+
+// commitBatch stores the comics mapped since the last commit and logs
+// next as the first comic to download on the next update
+func commitBatch(next int) error {
+	if len(DataMap) > 0 {
+		if err := storeIndexMap(IndexMap); err != nil {
+			return fmt.Errorf("StoreIndexMap failed: %v", err)
+		}
+		if err := storeMapData(DataMap); err != nil {
+			return fmt.Errorf("StoreMapData failed: %v", err)
+		}
+	}
+	if err := logIndexVar(next); err != nil {
+		return fmt.Errorf("logIndexVar failed: %v", err)
+	}
+	resetMaps()
+	return nil
+}
+
+// resetMaps clears the in-memory maps once they have been stored
+func resetMaps() {
+	IndexMap = make(map[string][]int)
+	DataMap = make(map[int]LogData)
+	FetchedMap = make(map[int]time.Time)
+	PendingMap = make(map[int]string)
+}
+
+// verifyBackfill reports comics from through to missing from the 'data' bucket
+func verifyBackfill(from, to int) error {
+	db, err := OpenDB(IndexPath())
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+	defer db.Close()
+
+	var missing []int
+	t := TraceTx("view", "data")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(Bucket("data"))
+		if b == nil {
+			return fmt.Errorf("'data' bucket not found")
+		}
+		for i := from; i <= to; i++ {
+			if i == 404 {
+				continue
+			}
+			t.Get()
+			if b.Get(Itob(i)) == nil {
+				missing = append(missing, i)
+			}
+		}
+		return nil
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		return fmt.Errorf("view op failed: %s", vErr)
+	}
+	if len(missing) > 0 {
+		fmt.Printf("verification: %v comics missing: %v\n", len(missing), missing)
+		return nil
+	}
+	fmt.Printf("verification: comics %v-%v stored\n", from, to)
+	return nil
+}
+
+// latestNum returns the number of the most recent comic, read from
+// xkcd.com's current comic info or the highest captured comic in 'ReplayDir'
+func latestNum() (int, error) {
+	return latestNumContext(context.Background())
+}
+
+// latestNumContext is latestNum, aborting the request once ctx is done
+func latestNumContext(ctx context.Context) (int, error) {
+	if ReplayDir != "" {
+		files, err := Files.ReadDir(ReplayDir)
+		if err != nil {
+			return 0, fmt.Errorf("replay read failed: %v", err)
+		}
+		latest := 0
+		for _, fi := range files {
+			n, err := strconv.Atoi(strings.TrimSuffix(fi.Name(), filepath.Ext(fi.Name())))
+			if err == nil && n > latest {
+				latest = n
+			}
+		}
+		return latest, nil
+	}
+
+	url := XKCDURL + "info.0.json"
+	resp, err := httpGet(ctx, url)
+	if err != nil {
+		return 0, &NetworkError{URL: url, Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, &NetworkError{URL: url, Status: resp.StatusCode, Err: fmt.Errorf("%s", resp.Status)}
+	}
+	var d LogData
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return 0, &NetworkError{URL: url, Err: err}
+	}
+	return int(d.Num), nil
+}
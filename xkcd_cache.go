@@ -0,0 +1,26 @@
+package xkcd
+
+import (
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+// InvalidateCache deletes the 'cache' bucket of query results and the
+// 'absent' bucket of terms without postings, and marks the year shards
+// out of date. It must be called in every transaction that changes the
+// 'main', 'data' or 'title' buckets.
+func InvalidateCache(tx *bolt.Tx) error {
+	if err := invalidateShards(tx); err != nil {
+		return err
+	}
+	for _, name := range []string{"cache", "absent"} {
+		if tx.Bucket(Bucket(name)) == nil {
+			continue
+		}
+		if err := tx.DeleteBucket(Bucket(name)); err != nil {
+			return fmt.Errorf("delete '%s' bucket failed:\n%s", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package xkcd
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// CachedComic returns comic num from the 'data' bucket of db, downloading
+// and indexing it first if it isn't stored. ok is false for comics that
+// don't exist.
+func CachedComic(db *bolt.DB, num int) (d LogData, ok bool, err error) {
+	var pb []byte
+	t := TraceTx("view", "data")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(Bucket("data")); b != nil {
+			pb = append([]byte(nil), b.Get(Itob(num))...)
+			t.Get()
+		}
+		return nil
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		return d, false, fmt.Errorf("view op failed: %s", vErr)
+	}
+	if len(pb) > 0 {
+		d, err = decodeLogData(pb)
+		return d, err == nil, err
+	}
+	if num == 404 { // special case - http 404 error page
+		return d, false, nil
+	}
+
+	respInfo, ok, err := fetchInfo(num)
+	if err != nil || !ok {
+		return d, false, err
+	}
+	if _, _, err := replaceComic(db, num, respInfo); err != nil {
+		return d, false, err
+	}
+	return CachedComic(db, num)
+}
+
+// LatestTTL is how long CachedLatest reuses the latest comic number it
+// looked up on xkcd.com before looking it up again
+var LatestTTL = time.Minute
+
+// latest is the latest comic number CachedLatest looked up, and when
+var latest struct {
+	sync.Mutex
+	num int
+	at  time.Time
+}
+
+// cachedLatestNum returns latestNum, looking it up at most once every
+// 'LatestTTL'
+func cachedLatestNum() (int, error) {
+	latest.Lock()
+	defer latest.Unlock()
+	if latest.num > 0 && time.Since(latest.at) < LatestTTL {
+		return latest.num, nil
+	}
+	num, err := latestNum()
+	if err != nil {
+		return 0, err
+	}
+	latest.num, latest.at = num, time.Now()
+	return num, nil
+}
+
+// CachedLatest returns the most recent comic as CachedComic does. The
+// latest comic number is looked up on xkcd.com at most once every
+// 'LatestTTL'. When xkcd.com can't be reached, the highest stored comic
+// is returned instead.
+func CachedLatest(db *bolt.DB) (LogData, bool, error) {
+	num, err := cachedLatestNum()
+	if err != nil {
+		num = 0
+		vErr := db.View(func(tx *bolt.Tx) error {
+			if b := tx.Bucket(Bucket("data")); b != nil {
+				if k, _ := b.Cursor().Last(); k != nil {
+					num = Btoi(k)
+				}
+			}
+			return nil
+		})
+		if vErr != nil || num == 0 {
+			return LogData{}, false, err
+		}
+	}
+	return CachedComic(db, num)
+}
@@ -0,0 +1,32 @@
+package xkcd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCachedLatestNum(t *testing.T) {
+	replayDir := ReplayDir
+	defer func() { ReplayDir = replayDir }()
+	ReplayDir = t.TempDir()
+	latest.num = 0
+	defer func() { latest.num = 0 }()
+	write := func(i int) {
+		if err := writeFile(capturePath(ReplayDir, i), []byte("{}"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(5)
+	if num, err := cachedLatestNum(); err != nil || num != 5 {
+		t.Fatalf("cachedLatestNum() = %v, %v, want 5", num, err)
+	}
+	write(9)
+	if num, _ := cachedLatestNum(); num != 5 {
+		t.Errorf("cachedLatestNum() within TTL = %v, want cached 5", num)
+	}
+	latest.at = time.Now().Add(-LatestTTL)
+	if num, _ := cachedLatestNum(); num != 9 {
+		t.Errorf("cachedLatestNum() after TTL = %v, want 9", num)
+	}
+}
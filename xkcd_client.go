@@ -0,0 +1,242 @@
+package xkcd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Doer sends an HTTP request and returns its response, as *http.Client
+// does. Wrapping a Doer adds instrumentation such as metrics or tracing.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Proxy is the URL of the proxy requests are sent through by the default
+// 'Client' (ex: http://proxy.example.com:3128). When nil, the proxy is
+// read from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment
+// variables.
+var Proxy *url.URL
+
+// Client sends every request the package makes to xkcd.com, and the
+// command's other downloads. Replace it with a configured *http.Client
+// to set TLS or connection pooling options (ex: xkcd.Client =
+// &http.Client{Transport: t}); 'Proxy' only applies to the default client.
+var Client Doer = &http.Client{Transport: offlineTransport{timeoutTransport{newTransport()}}}
+
+// Timeouts bound each request sent by the default 'Client', so a hung
+// connection can't stall an update; 0 disables a limit
+type Timeouts struct {
+	Connect time.Duration // to establish each TCP connection
+	Read    time.Duration // from sending a request until its response has been read
+}
+
+// RequestTimeouts are the timeouts of the default 'Client', read as each
+// request is sent
+var RequestTimeouts = Timeouts{Connect: 10 * time.Second, Read: 60 * time.Second}
+
+// newTransport returns the transport of the default 'Client': the
+// default transport's settings, with requests sent through 'Proxy' and
+// connections bounded by 'RequestTimeouts'
+func newTransport() *http.Transport {
+	t := &http.Transport{
+		Proxy: proxy,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			d := net.Dialer{Timeout: RequestTimeouts.Connect, KeepAlive: 30 * time.Second}
+			return d.DialContext(ctx, network, addr)
+		},
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	return t
+}
+
+// timeoutTransport cancels each request still running once the 'Read'
+// timeout of 'RequestTimeouts' has passed, including reading its body
+type timeoutTransport struct {
+	next http.RoundTripper
+}
+
+func (t timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if RequestTimeouts.Read <= 0 {
+		return t.next.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), RequestTimeouts.Read)
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = cancelBody{resp.Body, cancel}
+	return resp, nil
+}
+
+// cancelBody is a response body releasing its request's timeout once closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// proxy returns the proxy to send req through: 'Proxy' when set, and the
+// one set by the environment otherwise
+func proxy(req *http.Request) (*url.URL, error) {
+	if Proxy != nil {
+		return Proxy, nil
+	}
+	return http.ProxyFromEnvironment(req)
+}
+
+// UserAgent identifies the crawler in the User-Agent header of every
+// request, so operators of the servers it requests can tell who sent it
+var UserAgent = "tgpl_xkcd (+https://github.com/ggarcia209/tgpl_xkcd)"
+
+// Header holds additional headers sent with every request (ex: a From
+// header with the operator's email address)
+var Header = make(http.Header)
+
+// NewRequest returns a request for url with 'UserAgent' and 'Header' set,
+// as every request the package makes is sent
+func NewRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range Header {
+		req.Header[k] = append([]string(nil), vs...)
+	}
+	if UserAgent != "" {
+		req.Header.Set("User-Agent", UserAgent)
+	}
+	return req, nil
+}
+
+// RetryPolicy sets how requests failing with a network error or a 5xx
+// response are retried
+type RetryPolicy struct {
+	Attempts int           // attempts per request, including the first; 1 disables retries
+	Base     time.Duration // delay before the first retry, doubled before each further one
+	Max      time.Duration // longest delay between attempts
+}
+
+// Retry is the policy every request the package makes is retried with
+var Retry = RetryPolicy{Attempts: 3, Base: time.Second, Max: 30 * time.Second}
+
+// RateLimit is the most requests per second the package sends to
+// xkcd.com, shared by concurrent requests and retries so large crawls
+// are polite; 0 disables the limit
+var RateLimit = 10.0
+
+var (
+	limitMu  sync.Mutex
+	nextSlot time.Time // earliest time the next request may be sent
+)
+
+// waitTurn blocks until a request may be sent under 'RateLimit', or
+// until ctx is done
+func waitTurn(ctx context.Context) error {
+	if RateLimit <= 0 {
+		return nil
+	}
+	limitMu.Lock()
+	at := nextSlot
+	if now := time.Now(); at.Before(now) {
+		at = now
+	}
+	nextSlot = at.Add(time.Duration(float64(time.Second) / RateLimit))
+	limitMu.Unlock()
+	return sleepContext(ctx, time.Until(at))
+}
+
+// sleepContext pauses for d, returning ctx's error if ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// backoff returns the delay before retrying a request that has failed
+// 'attempt' times: exponential up to p.Max, with random jitter of up to
+// half of it so concurrent requests don't retry in lockstep
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.Base << uint(attempt-1)
+	if p.Base > 0 && d>>uint(attempt-1) != p.Base { // overflow
+		d = math.MaxInt64
+	}
+	if p.Max > 0 && d > p.Max {
+		d = p.Max
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// httpGet requests url with 'Client' at most 'RateLimit' times a second,
+// retrying transient failures with the 'Retry' policy and aborting once
+// ctx is done. Requests fail with
+// 'ErrOffline' while 'Offline' is set, whatever transport the client uses.
+func httpGet(ctx context.Context, url string) (*http.Response, error) {
+	return httpGetHeader(ctx, url, nil)
+}
+
+// httpGetHeader is httpGet, sending the additional headers h
+func httpGetHeader(ctx context.Context, url string, h http.Header) (*http.Response, error) {
+	if Offline {
+		return nil, ErrOffline
+	}
+	for attempt := 1; ; attempt++ {
+		if err := waitTurn(ctx); err != nil {
+			return nil, err
+		}
+		req, err := NewRequest(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		for k, vs := range h {
+			req.Header[k] = vs
+		}
+		resp, err := Client.Do(req)
+		if attempt >= Retry.Attempts || !transient(resp, err) || ctx.Err() != nil {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if err := sleepContext(ctx, Retry.backoff(attempt)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// transient reports whether a request that returned resp and err may
+// succeed if retried
+func transient(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, ErrOffline)
+	}
+	return resp.StatusCode >= 500
+}
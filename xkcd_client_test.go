@@ -0,0 +1,62 @@
+package xkcd
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{Attempts: 3, Base: time.Second, Max: 30 * time.Second}
+	for _, c := range []struct {
+		p        RetryPolicy
+		attempt  int
+		min, max time.Duration
+	}{
+		{p, 1, 500 * time.Millisecond, time.Second},
+		{p, 3, 2 * time.Second, 4 * time.Second},
+		{p, 10, 15 * time.Second, 30 * time.Second},  // capped
+		{p, 100, 15 * time.Second, 30 * time.Second}, // overflow
+		{RetryPolicy{Base: time.Second}, 4, 4 * time.Second, 8 * time.Second},
+		{RetryPolicy{Base: 0, Max: 30 * time.Second}, 3, 0, 0}, // no delay
+	} {
+		for i := 0; i < 20; i++ {
+			if d := c.p.backoff(c.attempt); d < c.min || d > c.max {
+				t.Errorf("%+v.backoff(%v) = %v, want between %v and %v", c.p, c.attempt, d, c.min, c.max)
+				break
+			}
+		}
+	}
+}
+
+func TestWaitTurn(t *testing.T) {
+	rate := RateLimit
+	defer func() { RateLimit, nextSlot = rate, time.Time{} }()
+	RateLimit = 50 // a slot every 20ms
+	limitMu.Lock()
+	nextSlot = time.Time{}
+	limitMu.Unlock()
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := waitTurn(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the first request goes at once, the others 20ms apart
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("4 requests at 50/s took %v, want at least 60ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	RateLimit = 0.1
+	if err := waitTurn(ctx); err != context.Canceled {
+		t.Errorf("waitTurn(canceled) = %v, want %v", err, context.Canceled)
+	}
+
+	RateLimit = 0
+	if err := waitTurn(context.Background()); err != nil {
+		t.Errorf("waitTurn() without a limit = %v", err)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// vector is a sparse TF-IDF vector
+type vector map[string]float64
+
+// cluster is a group of comics and its centroid
+type cluster struct {
+	Centroid vector
+	Members  []int // DocIDs
+}
+
+// clusterComics groups comics by term co-occurrence with k-means over
+// normalized TF-IDF vectors and labels each cluster with its top terms
+// ('xkcd cluster -k 12 -export')
+func clusterComics(args []string) error {
+	fs := flag.NewFlagSet("cluster", flag.ExitOnError)
+	k := fs.Int("k", 10, "number of clusters")
+	iter := fs.Int("iter", 20, "maximum k-means iterations")
+	seed := fs.Int64("seed", 1, "random seed for choosing initial centroids")
+	labels := fs.Int("labels", 8, "number of top terms to label each cluster with")
+	export := fs.Bool("export", false, "store assignments in the index as searchable 'cluster:N' terms")
+	fs.Parse(args)
+
+	if err := checkIndex(); err != nil {
+		return err
+	}
+	db, err := openIndex(*export)
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+
+	// build a TF-IDF vector for every comic
+	freqs, err := indexFreqs(db)
+	if err != nil {
+		return err
+	}
+	df := make(map[string]int)
+	for _, f := range freqs {
+		df[f.Term] = f.DF
+	}
+	var docs []int
+	var titles = make(map[int]string)
+	var tfs []map[string]int
+	err = eachComic(db, func(d xkcd.LogData) {
+		docs = append(docs, int(d.Num))
+		titles[int(d.Num)] = d.Title
+		tfs = append(tfs, termFreqsOf(d))
+	})
+	if err != nil {
+		return err
+	}
+	vecs := make([]vector, len(tfs))
+	for i, tf := range tfs {
+		v := make(vector)
+		for t, f := range tf {
+			if df[t] > 1 && !strings.HasPrefix(t, xkcd.ClusterPrefix) {
+				v[t] = float64(f) * math.Log(float64(len(docs))/float64(df[t]))
+			}
+		}
+		vecs[i] = normalize(v)
+	}
+	if *k < 1 || *k > len(vecs) {
+		return usageErrorf("k must be between 1 and the number of comics (%v)", len(vecs))
+	}
+
+	clusters := kmeans(vecs, docs, *k, *iter, rand.New(rand.NewSource(*seed)))
+	for i, c := range clusters {
+		fmt.Printf("cluster %d (%d comics): %v\n", i, len(c.Members), topWeights(c.Centroid, *labels))
+		for j, m := range c.Members {
+			if j == 5 {
+				fmt.Printf("\t...\n")
+				break
+			}
+			fmt.Printf("\t%d: %s\n", m, titles[m])
+		}
+	}
+
+	if *export {
+		if err := exportClusters(db, clusters); err != nil {
+			return err
+		}
+		fmt.Printf("\ncluster assignments stored as '%sN' terms\n", xkcd.ClusterPrefix)
+	}
+	return nil
+}
+
+// kmeans partitions vecs (with DocIDs docs) into k clusters by cosine similarity
+func kmeans(vecs []vector, docs []int, k, iter int, r *rand.Rand) []cluster {
+	clusters := make([]cluster, k)
+	for i, j := range r.Perm(len(vecs))[:k] {
+		clusters[i].Centroid = vecs[j]
+	}
+
+	assign := make([]int, len(vecs))
+	for it := 0; it < iter; it++ {
+		changed := false
+		for i, v := range vecs {
+			best, bestSim := 0, -1.0
+			for c := range clusters {
+				if sim := dot(v, clusters[c].Centroid); sim > bestSim {
+					best, bestSim = c, sim
+				}
+			}
+			if it == 0 || assign[i] != best {
+				assign[i] = best
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+
+		// move each centroid to the mean of its members
+		sums := make([]vector, k)
+		for c := range sums {
+			sums[c] = make(vector)
+		}
+		for i, v := range vecs {
+			for t, w := range v {
+				sums[assign[i]][t] += w
+			}
+		}
+		for c := range clusters {
+			if len(sums[c]) > 0 { // keep previous centroid if cluster emptied
+				clusters[c].Centroid = normalize(sums[c])
+			}
+		}
+	}
+
+	for i, c := range assign {
+		clusters[c].Members = append(clusters[c].Members, docs[i])
+	}
+	return clusters
+}
+
+// exportClusters replaces the 'cluster:N' terms in the inverted index
+// with the DocIDs of each cluster
+func exportClusters(db *bolt.DB, clusters []cluster) error {
+	t := xkcd.TraceTx("update", "main")
+	uErr := db.Update(func(tx *bolt.Tx) error {
+		if err := xkcd.InvalidateCache(tx); err != nil {
+			return err
+		}
+		b := tx.Bucket(xkcd.Bucket("main"))
+		var old [][]byte
+		c := b.Cursor()
+		prefix := []byte(xkcd.ClusterPrefix)
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			old = append(old, k)
+		}
+		for _, k := range old {
+			if err := b.Delete(k); err != nil {
+				return fmt.Errorf("delete failed:\n%s", err)
+			}
+			t.Delete()
+		}
+		for i, cl := range clusters {
+			k := []byte(xkcd.ClusterPrefix + strconv.Itoa(i))
+			refs := append([]int(nil), cl.Members...)
+			sort.Ints(refs)
+			if err := b.Put(k, xkcd.Istobs(refs)); err != nil {
+				return fmt.Errorf("put failed:\n%s", err)
+			}
+			t.Put(k, xkcd.Istobs(refs))
+		}
+		return nil
+	})
+	t.Done(uErr)
+	if uErr != nil {
+		return fmt.Errorf("update transaction failed:\n%w", uErr)
+	}
+	return nil
+}
+
+// normalize scales v to unit length
+func normalize(v vector) vector {
+	var sum float64
+	for _, w := range v {
+		sum += w * w
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := math.Sqrt(sum)
+	for t := range v {
+		v[t] /= norm
+	}
+	return v
+}
+
+// dot returns the dot product of a and b
+func dot(a, b vector) float64 {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	var sum float64
+	for t, w := range a {
+		sum += w * b[t]
+	}
+	return sum
+}
+
+// topWeights returns the n terms of v with the highest weights
+func topWeights(v vector, n int) []string {
+	var terms []string
+	for t := range v {
+		terms = append(terms, t)
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if v[terms[i]] != v[terms[j]] {
+			return v[terms[i]] > v[terms[j]]
+		}
+		return terms[i] < terms[j]
+	})
+	if len(terms) > n {
+		terms = terms[:n]
+	}
+	return terms
+}
@@ -0,0 +1,73 @@
+package xkcd
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Comic is a comic as exposed by the package's API, with typed fields
+// instead of the strings of xkcd.com's JSON info kept by 'LogData' and
+// stored as 'LogDataStruct' protocol buffers
+type Comic struct {
+	Num         int
+	PublishedAt time.Time // zero if the stored date is invalid
+	Title       string
+	SafeTitle   string
+	Alt         string
+	Transcript  string
+	News        string
+	Image       *url.URL // nil if the comic has no valid image URL
+	Link        *url.URL // the comic's page on xkcd.com, or the related page its info links to
+}
+
+// NewComic returns the Comic of the stored or downloaded data d.
+// Malformed dates and URLs are left zero rather than failing, as some
+// early comics have unusual values.
+func NewComic(d LogData) Comic {
+	c := Comic{
+		Num:        int(d.Num),
+		Title:      d.Title,
+		SafeTitle:  d.SafeTitle,
+		Alt:        d.Alt,
+		Transcript: d.Transcript,
+		News:       d.News,
+	}
+	y, yErr := strconv.Atoi(d.Year)
+	m, mErr := strconv.Atoi(d.Month)
+	day, dErr := strconv.Atoi(d.Day)
+	if yErr == nil && mErr == nil && dErr == nil {
+		c.PublishedAt = time.Date(y, time.Month(m), day, 0, 0, 0, 0, time.UTC)
+	}
+	if u, err := url.Parse(d.Img); err == nil && d.Img != "" {
+		c.Image = u
+	}
+	link := d.Link
+	if link == "" {
+		link = XKCDURL + strconv.Itoa(c.Num)
+	}
+	if u, err := url.Parse(link); err == nil {
+		c.Link = u
+	}
+	return c
+}
+
+// StoredComic returns comic num from the 'data' bucket, and false if it
+// isn't stored
+func StoredComic(tx *bolt.Tx, num int) (Comic, bool, error) {
+	b := tx.Bucket(Bucket("data"))
+	if b == nil {
+		return Comic{}, false, nil
+	}
+	pb := b.Get(Itob(num))
+	if pb == nil {
+		return Comic{}, false, nil
+	}
+	d, err := decodeLogData(pb)
+	if err != nil {
+		return Comic{}, false, err
+	}
+	return NewComic(d), true, nil
+}
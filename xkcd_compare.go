@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// queryFilters are the comparisons of the current search
+var queryFilters []comparison
+
+// comparisonTerm matches a field comparison in a query (ex: 'year>2015')
+var comparisonTerm = regexp.MustCompile(`^(year|month|day|num|date)(<=|>=|!=|<|>|=)(.+)$`)
+
+// comparison filters search results on a numeric or date field. Dates are
+// compared as YYYYMMDD integers.
+type comparison struct {
+	Field string
+	Op    string
+	Value int
+}
+
+// parseQuery splits a query into its terms and field comparisons
+// (ex: 'physics year>2015 num<2000')
+func parseQuery(text string) (terms []string, filters []comparison, err error) {
+	for _, w := range strings.Fields(text) {
+		m := comparisonTerm.FindStringSubmatch(strings.ToLower(w))
+		if m == nil {
+			terms = append(terms, w)
+			continue
+		}
+		c := comparison{Field: m[1], Op: m[2]}
+		if c.Field == "date" {
+			t, pErr := parsePeriodDate(m[3])
+			if pErr != nil {
+				return nil, nil, usageErrorf("invalid comparison %q: %v", w, pErr)
+			}
+			c.Value = t
+		} else if c.Value, err = strconv.Atoi(m[3]); err != nil {
+			return nil, nil, usageErrorf("invalid comparison %q: expected a number", w)
+		}
+		filters = append(filters, c)
+	}
+	return terms, filters, nil
+}
+
+// parsePeriodDate parses a 'YYYY-MM-DD' date as a YYYYMMDD integer,
+// rejecting months and days that don't exist (ex: '2015-13-45')
+func parsePeriodDate(s string) (int, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 3 {
+		return 0, usageErrorf("expected YYYY-MM-DD")
+	}
+	var ymd [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return 0, usageErrorf("expected YYYY-MM-DD")
+		}
+		ymd[i] = n
+	}
+	t := time.Date(ymd[0], time.Month(ymd[1]), ymd[2], 0, 0, 0, 0, time.UTC)
+	if t.Year() != ymd[0] || int(t.Month()) != ymd[1] || t.Day() != ymd[2] {
+		return 0, usageErrorf("no such date: %s", s)
+	}
+	return ymd[0]*10000 + ymd[1]*100 + ymd[2], nil
+}
+
+// field returns the value of c's field in d
+func (c comparison) field(d xkcd.LogData) int {
+	y, _ := strconv.Atoi(d.Year)
+	m, _ := strconv.Atoi(d.Month)
+	day, _ := strconv.Atoi(d.Day)
+	switch c.Field {
+	case "year":
+		return y
+	case "month":
+		return m
+	case "day":
+		return day
+	case "num":
+		return int(d.Num)
+	default: // date
+		return y*10000 + m*100 + day
+	}
+}
+
+// matches reports whether d satisfies c
+func (c comparison) matches(d xkcd.LogData) bool {
+	v := c.field(d)
+	switch c.Op {
+	case "<":
+		return v < c.Value
+	case "<=":
+		return v <= c.Value
+	case ">":
+		return v > c.Value
+	case ">=":
+		return v >= c.Value
+	case "!=":
+		return v != c.Value
+	default: // =
+		return v == c.Value
+	}
+}
+
+// matchesFilters reports whether d satisfies every comparison in 'queryFilters'
+func matchesFilters(d xkcd.LogData) bool {
+	for _, c := range queryFilters {
+		if !c.matches(d) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterComparisons returns the comics in data satisfying 'queryFilters'
+func filterComparisons(data []xkcd.LogData) []xkcd.LogData {
+	if len(queryFilters) == 0 {
+		return data
+	}
+	var in []xkcd.LogData
+	for _, d := range data {
+		if matchesFilters(d) {
+			in = append(in, d)
+		}
+	}
+	return in
+}
+
+// allRefs returns the DocID of every stored comic, for queries made of
+// comparisons only
+func allRefs() ([]int, error) {
+	db, err := openIndex(false)
+	if err != nil {
+		return nil, fmt.Errorf("db failed to open:\n%s", err)
+	}
+	var refs []int
+	t := xkcd.TraceTx("view", "data")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(xkcd.Bucket("data"))
+		if b == nil {
+			return indexErrorf("data index not found - run with -u first")
+		}
+		return b.ForEach(func(k, _ []byte) error {
+			t.Get()
+			refs = append(refs, xkcd.Btoi(k))
+			return nil
+		})
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		return nil, fmt.Errorf("view op failed: %w", vErr)
+	}
+	return refs, nil
+}
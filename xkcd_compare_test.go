@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+func TestParseQuery(t *testing.T) {
+	terms, filters, err := parseQuery("physics Year>2015 num<=2000 date=2016-02-29")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(terms, []string{"physics"}) {
+		t.Errorf("terms = %v, want [physics]", terms)
+	}
+	want := []comparison{
+		{"year", ">", 2015},
+		{"num", "<=", 2000},
+		{"date", "=", 20160229},
+	}
+	if !reflect.DeepEqual(filters, want) {
+		t.Errorf("filters = %v, want %v", filters, want)
+	}
+}
+
+func TestParseQueryInvalid(t *testing.T) {
+	for _, q := range []string{
+		"year>abc",
+		"date>2015",
+		"date>2015-13-01",
+		"date>2015-02-29",
+		"date>2015-12-45",
+		"date>2015-00-10",
+	} {
+		if _, _, err := parseQuery(q); exitCode(err) != exitUsage {
+			t.Errorf("parseQuery(%q) error = %v, want a usage error", q, err)
+		}
+	}
+}
+
+func TestComparisonMatches(t *testing.T) {
+	d := xkcd.LogData{Num: 1500, Year: "2015", Month: "3", Day: "9"}
+	for _, c := range []struct {
+		c    comparison
+		want bool
+	}{
+		{comparison{"year", "=", 2015}, true},
+		{comparison{"year", "!=", 2015}, false},
+		{comparison{"month", "<", 3}, false},
+		{comparison{"month", "<=", 3}, true},
+		{comparison{"day", ">", 8}, true},
+		{comparison{"num", ">=", 1501}, false},
+		{comparison{"date", ">", 20150308}, true},
+		{comparison{"date", "<", 20150309}, false},
+	} {
+		if got := c.c.matches(d); got != c.want {
+			t.Errorf("%v.matches(%+v) = %v, want %v", c.c, d, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// defaultConfig is the config file read when '-config' isn't given
+const defaultConfig = "xkcd_config.json"
+
+// configPoll is how often long-running commands check the config file
+// for changes
+const configPoll = 2 * time.Second
+
+// config is the JSON config file
+type config struct {
+	// Tokenize replaces the default character-filtering rules text is
+	// indexed with (ex: {"replace": [{"pattern": "'", "with": ""}], "split": "[^a-z0-9]+"})
+	Tokenize *xkcd.TokenRules `json:"tokenize"`
+
+	// Interval is the time between checks for new comics in watch mode
+	// when -interval isn't given (ex: "30m")
+	Interval string `json:"interval,omitempty"`
+
+	// Schedule updates the proxy's namespaces periodically as
+	// name=interval pairs when -schedule isn't given (ex: "default=1h,whatif=24h")
+	Schedule string `json:"schedule,omitempty"`
+}
+
+var (
+	configPath     string // config file in use
+	configExplicit bool   // whether the config file was named with -config
+	activeConfig   config // last config applied
+)
+
+// loadConfig applies the config file at path. A missing file is only an
+// error when it was named explicitly.
+func loadConfig(path string, explicit bool) error {
+	configPath, configExplicit = path, explicit
+	c, err := readConfig(path, explicit)
+	if err != nil {
+		return usageErrorf("%v", err)
+	}
+	if err := applyConfig(c); err != nil {
+		return usageErrorf("config %s: %v", path, err)
+	}
+	return nil
+}
+
+// readConfig reads and validates the config file at path. A missing file
+// reads as the empty config unless it was named explicitly.
+func readConfig(path string, explicit bool) (config, error) {
+	var c config
+	f, err := os.Open(path)
+	if os.IsNotExist(err) && !explicit {
+		return c, nil
+	}
+	if err != nil {
+		return c, fmt.Errorf("config: %v", err)
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return c, fmt.Errorf("config %s: %v", path, err)
+	}
+	if c.Interval != "" {
+		if d, err := time.ParseDuration(c.Interval); err != nil || d <= 0 {
+			return c, fmt.Errorf("config %s: invalid interval %q", path, c.Interval)
+		}
+	}
+	return c, nil
+}
+
+// applyConfig makes c the active config. Tokenization rules missing from
+// c revert to the defaults.
+func applyConfig(c config) error {
+	rules := xkcd.DefaultTokenRules
+	if c.Tokenize != nil {
+		rules = *c.Tokenize
+	}
+	if err := xkcd.SetTokenRules(rules); err != nil {
+		return err
+	}
+	activeConfig = c
+	return nil
+}
+
+// configReloads sends the config each time the config file changes or
+// the process receives SIGHUP, so long-running commands can apply it at
+// a safe point without restarting. The file is checked every
+// 'configPoll'; configs that fail to read are reported and skipped.
+func configReloads() <-chan config {
+	reloads := make(chan config)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		modTime := configModTime()
+		tick := time.NewTicker(configPoll)
+		for {
+			select {
+			case <-hup:
+			case <-tick.C:
+				if configModTime().Equal(modTime) {
+					continue
+				}
+			}
+			modTime = configModTime()
+			c, err := readConfig(configPath, configExplicit)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s config reload failed: %v\n", time.Now().Format(time.RFC3339), err)
+				continue
+			}
+			reloads <- c
+		}
+	}()
+	return reloads
+}
+
+// configModTime returns the modification time of the config file, or the
+// zero time if it doesn't exist
+func configModTime() time.Time {
+	fi, err := os.Stat(configPath)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// reloadConfig applies a reloaded config c, reporting the outcome
+func reloadConfig(c config) bool {
+	now := time.Now().Format(time.RFC3339)
+	if err := applyConfig(c); err != nil {
+		fmt.Fprintf(os.Stderr, "%s config reload failed: %v\n", now, err)
+		return false
+	}
+	fmt.Printf("%s config reloaded from %s\n", now, configPath)
+	return true
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/boltdb/bolt"
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// cooccurrence is a term and the number of comics it shares with another term
+type cooccurrence struct {
+	Term   string
+	Shared int
+	DF     int
+}
+
+// restrictRefs returns the DocIDs in refs found in docs, or refs if docs is nil
+func restrictRefs(refs []int, docs map[int]bool) []int {
+	if docs == nil {
+		return refs
+	}
+	var in []int
+	for _, v := range refs {
+		if docs[v] {
+			in = append(in, v)
+		}
+	}
+	return in
+}
+
+// cooccurringTerms lists the terms that most often appear in the same
+// comics as a term, computed from the inverted index ('xkcd cooccur mars')
+func cooccurringTerms(args []string) error {
+	fs := flag.NewFlagSet("cooccur", flag.ExitOnError)
+	n := fs.Int("n", 25, "number of terms to list")
+	pos := parseArgs(fs, args)
+
+	var query []string
+	if len(pos) == 1 {
+		query = xkcd.Tokenize(pos[0])
+	}
+	if len(query) != 1 {
+		return usageErrorf("usage: xkcd cooccur <term>")
+	}
+	term := query[0]
+	if *n < 1 {
+		return usageErrorf("-n must be at least 1")
+	}
+
+	if err := checkIndex(); err != nil {
+		return err
+	}
+	db, err := openIndex(false)
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+
+	var inPeriod map[int]bool
+	if activePeriod != nil {
+		if inPeriod, err = periodDocs(db); err != nil {
+			return err
+		}
+	}
+
+	var refs []int
+	var terms []cooccurrence
+	t := xkcd.TraceTx("view", "main")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(xkcd.Bucket("main"))
+		if b == nil {
+			return indexErrorf("index not found - run with -u first")
+		}
+		refs = restrictRefs(xkcd.Bstois(b.Get([]byte(term))), inPeriod)
+		t.Get()
+		if len(refs) == 0 {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			t.Get()
+			if string(k) == term {
+				continue
+			}
+			other := restrictRefs(xkcd.Bstois(v), inPeriod)
+			if len(other) == 0 {
+				continue
+			}
+			if shared := len(intersection(refs, other)); shared > 0 {
+				terms = append(terms, cooccurrence{string(k), shared, len(other)})
+			}
+		}
+		return nil
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		return fmt.Errorf("view op failed: %w", vErr)
+	}
+	if len(refs) == 0 {
+		return fmt.Errorf("term '%s' not found in index", term)
+	}
+
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].Shared != terms[j].Shared {
+			return terms[i].Shared > terms[j].Shared
+		}
+		return terms[i].Term < terms[j].Term
+	})
+	if len(terms) > *n {
+		terms = terms[:*n]
+	}
+	fmt.Printf("terms co-occurring with '%s' (%v comics)\n\n", term, len(refs))
+	for i, c := range terms {
+		fmt.Printf("%4d\t%-20s\t%5d shared\t%5.1f%% of its comics\n",
+			i+1, c.Term, c.Shared, 100*float64(c.Shared)/float64(c.DF))
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+package main
+
+import "testing"
+
+func TestCooccurringTermsNegativeN(t *testing.T) {
+	if got := exitCode(cooccurringTerms([]string{"-n", "-1", "bitcoin"})); got != exitUsage {
+		t.Errorf("exit code = %v, want %v", got, exitUsage)
+	}
+}
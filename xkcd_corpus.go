@@ -0,0 +1,59 @@
+package xkcd
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Document is a text from another corpus (ex: what-if articles, blag
+// posts, local notes) to be indexed alongside the comics
+type Document struct {
+	Title string
+	Text  string
+	Link  string
+	Date  time.Time
+}
+
+// AddDocuments indexes docs in 'Namespace' with the same analyzer as the
+// comics, assigning each the next DocID, and returns their DocIDs. Their
+// text is stored and searched as the transcript.
+func AddDocuments(docs []Document) ([]int, error) {
+	GetIndex()
+	defer resetMaps()
+
+	var ids []int
+	for _, doc := range docs {
+		d := LogData{
+			Num:        int32(Index),
+			Title:      doc.Title,
+			SafeTitle:  doc.Title,
+			Transcript: doc.Text,
+			Link:       doc.Link,
+		}
+		if !doc.Date.IsZero() {
+			d.Year = strconv.Itoa(doc.Date.Year())
+			d.Month = strconv.Itoa(int(doc.Date.Month()))
+			d.Day = strconv.Itoa(doc.Date.Day())
+		}
+		mapTerms(formatMapData(mapDataOf(d)))
+		DataMap[Index] = d
+		FetchedMap[Index] = time.Now()
+		ids = append(ids, Index)
+		Index++
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	if err := storeIndexMap(IndexMap); err != nil {
+		return nil, fmt.Errorf("StoreIndexMap failed: %v", err)
+	}
+	if err := storeMapData(DataMap); err != nil {
+		return nil, fmt.Errorf("StoreMapData failed: %v", err)
+	}
+	if err := logIndexVar(Index); err != nil {
+		return nil, fmt.Errorf("logIndexVar failed: %v", err)
+	}
+	return ids, nil
+}
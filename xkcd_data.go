@@ -5,16 +5,19 @@ package xkcd
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
-	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/boltdb/bolt"
 	proto "github.com/golang/protobuf/proto"
@@ -36,6 +39,14 @@ var IndexMap = make(map[string][]int)
 // DataMap stores the Index and LogData of each json file as key: value pairs
 var DataMap = make(map[int]LogData)
 
+// FetchWorkers is the number of comics GetInfo downloads concurrently
+var FetchWorkers = 1
+
+// Checkpoint is the number of comics GetInfo maps before storing them,
+// so an interrupted update loses at most that many; 0 stores them only
+// once every comic has been downloaded
+var Checkpoint = 100
+
 // Entry formats JSON data for storing to log file.
 type Entry struct {
 	Index int
@@ -43,14 +54,15 @@ type Entry struct {
 }
 
 // LogData stores unmarshalled JSON data and is used to
-// encode/decode data as protocol buffers for db storage
+// encode/decode data as protocol buffers for db storage.
+// It is a storage detail; the API exposes comics as 'Comic'.
 type LogData struct {
 	Month      string
 	Num        int32
 	Link       string
 	Year       string
-	News       string `json:"omitempty"`
-	SafeTitle  string `json:"omitempty"`
+	News       string `json:"news,omitempty"`
+	SafeTitle  string `json:"safe_title,omitempty"`
 	Transcript string
 	Alt        string
 	Img        string
@@ -63,9 +75,10 @@ type LogData struct {
 // Search by month/day functionality may be added in future version
 type MapData struct {
 	Num        int
+	Link       string `json:"link"` // only related pages; empty for most comics
 	Year       string
-	News       string `json:"omitempty"`
-	SafeTitle  string `json:"omitempty"`
+	News       string `json:"news,omitempty"`
+	SafeTitle  string `json:"safe_title,omitempty"`
 	Transcript string
 	Alt        string
 	Title      string
@@ -74,117 +87,436 @@ type MapData struct {
 // GetIndex updates 'Index' var in memory from persistent value stored in 'log.db'
 // GetIndex allows for constant look up time vs. scanning over each existing entry in linear time
 func GetIndex() {
-	if _, err := os.Stat("log.db"); os.IsNotExist(err) {
+	if err := GetIndexContext(context.Background()); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// GetIndexContext is GetIndex, failing with ctx's error if ctx is done
+// while waiting for another process's lock on 'log.db'
+func GetIndexContext(ctx context.Context) error {
+	if _, err := Files.Stat(LogDBPath()); os.IsNotExist(err) {
 		// 'log.db' does not exist
 		fmt.Print("log.db not found\n")
 		Index = 1
 		fmt.Printf("index at start = %v\n", Index)
-	} else {
-		fmt.Print("log.db found\n")
-		Index = viewLogDb()
-		fmt.Printf("index at start = %v\n", Index)
+		return nil
+	}
+	fmt.Print("log.db found\n")
+	index, err := viewLogDb(ctx)
+	if err != nil {
+		return err
 	}
-	return
+	Index = index
+	fmt.Printf("index at start = %v\n", Index)
+	return nil
 }
 
-// GetInfo retrieves JSON info for each comic's webpage,
+// GetInfo retrieves JSON info for each comic's webpage published since
+// the last update, up to the latest comic number,
 // maps each term in each response to in-memory inverted index,
 // and writes unmarshalled data to file as an append-only log.
+// The mapped comics are stored every 'Checkpoint' comics, and the
+// OnProgress hooks are called after each comic.
+// Comics are downloaded by 'FetchWorkers' concurrent requests but mapped
+// in order, so each is assigned the same DocID as in a sequential run.
+// A summary of the update is printed and stored once it finishes.
 func GetInfo() error {
-	// Open or create file as append-only
-	f, err := os.OpenFile("comic_log.txt", os.O_RDWR|os.O_APPEND|os.O_CREATE, 0766)
+	return GetInfoContext(context.Background())
+}
+
+// GetInfoContext is GetInfo, stopping the downloads once ctx is done.
+// The comics mapped before then are stored as usual, so the next update
+// resumes after them, and ctx's error is returned.
+func GetInfoContext(ctx context.Context) (err error) {
+	startRun()
+	defer func() { finishRun(err) }()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := RetryPending(); err != nil {
+		return err
+	}
+	latest, err := latestNumContext(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to open comic_log.txt: %v", err)
+		return err
 	}
+	if Index > latest {
+		fmt.Println("no new comics")
+		return nil
+	}
+	n := latest - Index + 1
+	if Index <= 404 && latest >= 404 { // no comic 404
+		n--
+	}
+	fmt.Printf("%v new comics\n", n)
 
 	// Get JSON data from each comic's URL
 	fmt.Printf("downloading and mapping JSON info...\n")
-	for i := Index; i > 0; i++ { // increment +1 for next url
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := fetchOrdered(ctx, Index, latest, FetchWorkers)
+	var canceled error
+	// comics mapped since the last checkpoint
+	batch := make(map[int]LogData)
+	progress := Progress{Total: n}
+	report := func(num int, err error) {
+		progress.Num, progress.Err = num, err
+		progress.Done++
+		if err != nil {
+			progress.Failed++
+		}
+		progress.Elapsed = time.Since(LastRun.Started)
+		progressed(progress)
+	}
+	for i := Index; i <= latest; i++ { // increment +1 for next url
 		if i == 404 { // skip special case - http 404 error page
+			LastRun.Skipped = append(LastRun.Skipped, i)
 			Index++
 			continue
 		}
 
-		jsonURL := XKCDURL + strconv.Itoa(i) + "/info.0.json"
 		URL = XKCDURL + strconv.Itoa(i)
-		resp, err := http.Get(jsonURL) // "https://xkcd.com/i/info.0.json"
-		if err != nil {
-			resp.Body.Close()
-			return fmt.Errorf("request failed: %s\n http responses processed: %v", err, Index)
+		r, more := <-results
+		if !more || ctx.Err() != nil { // store the comics mapped so far
+			canceled = ctx.Err()
+			break
 		}
-		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
-			resp.Body.Close()
-			return fmt.Errorf("request failed: %s\n http responses processed: %v", resp.Status, Index)
+		respInfo, ok, err := r.Info, r.OK, r.Err
+		var netErr *NetworkError
+		if errors.As(err, &netErr) { // queue for retry on the next update
+			fmt.Printf("file failed: %v (%v)\n", i, err)
+			PendingMap[i] = err.Error()
+			LastRun.Failed[i] = err.Error()
+			noteFailure(i, "fetch", err)
+			report(i, err)
+			Index++
+			continue
 		}
-		if resp.StatusCode == http.StatusNotFound { // Break loop after most recent comic
-			break
+		if err != nil {
+			noteFailure(i, "fetch", err)
+			report(i, err)
+			if cErr := checkpoint(batch, Index); cErr != nil {
+				return cErr
+			}
+			return fmt.Errorf("request failed: %w\n http responses processed: %v", err, Index)
 		}
-
-		// Convert JSON info in HTTP response to byte array
-		respInfo, err := ioutil.ReadAll(resp.Body)
-		resp.Body.Close()
+		if !ok { // skip comics missing below the latest number
+			LastRun.Skipped = append(LastRun.Skipped, i)
+			report(i, nil)
+			Index++
+			continue
+		}
+		LastRun.Fetched++
+		LastRun.Bytes += int64(len(respInfo))
 
 		// Map terms and data in memory & write raw data to log file
 		mapTerms(formatEntry(respInfo))
 		mapData(respInfo, Index)
-		wErr := writeOutput(f, respInfo)
+		wErr := writeOutput(respInfo)
 		if wErr != nil {
-			return fmt.Errorf("Write to comic_log.txt failed:\n%v", err)
+			return fmt.Errorf("Write to %s failed:\n%v", LogFile(), wErr)
 		}
 
 		fmt.Printf("file processed: %v\n", (Index))
+		progress.Fetched++
+		report(i, nil)
+		batch[Index] = DataMap[Index]
 		Index++ // increment index/DocID for every http response processed
 
+		if Checkpoint > 0 && len(batch) >= Checkpoint {
+			if err := checkpoint(batch, Index); err != nil {
+				return err
+			}
+			batch = make(map[int]LogData)
+			fmt.Printf("checkpoint saved: next comic %v\n", Index)
+		}
 	}
-	f.Close()
 	fmt.Printf("in memory map created\ntotal files processed: %v\n", (Index - 1))
 
-	// Store IndexMap, DataMap and Index on disk
-	sErr := storeIndexMap(IndexMap)
-	if sErr != nil {
-		return fmt.Errorf("StoreIndexMap failed: %v", sErr)
+	// Store the rest of IndexMap and DataMap, and Index, on disk
+	if err := checkpoint(batch, Index); err != nil {
+		return err
 	}
-	fmt.Println("inverted index saved to disk")
-
-	sErr = storeMapData(DataMap)
-	if sErr != nil {
-		return fmt.Errorf("StoreMapData failed: %v", sErr)
+	fmt.Println("index and data maps saved to disk")
+	if len(PendingMap) > 0 {
+		fmt.Printf("failed comics queued for retry: %v\n", len(PendingMap))
 	}
-	fmt.Println("data map saved to disk")
+	fmt.Println("index logged on disk for next execution")
 
-	lErr := logIndexVar(Index)
-	if lErr != nil {
-		return fmt.Errorf("StoreIndexMap failed: %v", sErr)
+	if canceled != nil {
+		return fmt.Errorf("update canceled: %w\n http responses processed: %v", canceled, Index-1)
 	}
-	fmt.Println("index logged on disk for next execution")
+	return nil
+}
 
+// checkpoint stores the comics in batch, mapped since the last
+// checkpoint, with their postings in IndexMap and the comics queued for
+// retry, and logs next as the first comic to download on the next update.
+// IndexMap is cleared once stored; DataMap keeps every comic of the run.
+func checkpoint(batch map[int]LogData, next int) error {
+	if len(batch) > 0 {
+		if err := storeIndexMap(IndexMap); err != nil {
+			return fmt.Errorf("StoreIndexMap failed: %v", err)
+		}
+		if err := storeMapData(batch); err != nil {
+			return fmt.Errorf("StoreMapData failed: %v", err)
+		}
+		IndexMap = make(map[string][]int)
+	}
+	if len(PendingMap) > 0 {
+		if err := storePending(PendingMap); err != nil {
+			return fmt.Errorf("storePending failed: %v", err)
+		}
+	}
+	if err := logIndexVar(next); err != nil {
+		return fmt.Errorf("logIndexVar failed: %v", err)
+	}
 	return nil
 }
 
+// fetchOrdered downloads comics from through to (except 404) with up to
+// 'workers' concurrent requests and sends each response on the returned
+// channel in comic order. Responses arriving early are held until the
+// comics before them have been sent. The downloads stop, and the channel
+// is closed, once ctx is done.
+func fetchOrdered(ctx context.Context, from, to, workers int) <-chan fetchResult {
+	if workers < 1 {
+		workers = 1
+	}
+	done := ctx.Done()
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		for i := from; i <= to; i++ {
+			if i == 404 {
+				continue
+			}
+			select {
+			case jobs <- i:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	unordered := make(chan fetchResult, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				info, ok, err := fetchInfoContext(ctx, i)
+				select {
+				case unordered <- fetchResult{i, info, ok, err}:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(unordered)
+	}()
+
+	results := make(chan fetchResult)
+	go func() {
+		defer close(results)
+		pending := make(map[int]fetchResult)
+		next := from
+		for r := range unordered {
+			pending[r.Num] = r
+			for {
+				if next == 404 {
+					next++
+				}
+				r, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				select {
+				case results <- r:
+				case <-done:
+					return
+				}
+				next++
+			}
+		}
+	}()
+	return results
+}
+
+// NetworkError reports a failed request to xkcd.com
+type NetworkError struct {
+	URL    string
+	Status int // http status code, 0 if no response was received
+	Err    error
+}
+
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf("%s: %s", e.URL, e.Err)
+}
+
+// fetchInfo returns the raw JSON info for comic i, read from 'ReplayDir'
+// when set and downloaded from xkcd.com otherwise. ok is false once the
+// most recent comic has been passed (http 404 or no captured file).
+func fetchInfo(i int) (respInfo []byte, ok bool, err error) {
+	return fetchInfoContext(context.Background(), i)
+}
+
+// fetchInfoContext is fetchInfo, aborting the request once ctx is done
+func fetchInfoContext(ctx context.Context, i int) (respInfo []byte, ok bool, err error) {
+	respInfo, _, ok, err = fetchInfoIf(ctx, i, validator{})
+	return respInfo, ok, err
+}
+
+// fetchInfoIf is fetchInfoContext, requesting comic i's info only if it
+// has changed since it was downloaded with the validator cond, and also
+// returning the validator of the response. It fails with errNotModified
+// if the info hasn't changed.
+func fetchInfoIf(ctx context.Context, i int, cond validator) (respInfo []byte, v validator, ok bool, err error) {
+	fetchStarted(i)
+	defer func() {
+		if ok {
+			comicFetched(i, respInfo)
+		}
+	}()
+	if ReplayDir != "" {
+		respInfo, ok, err = replayInfo(i)
+		return respInfo, v, ok, err
+	}
+
+	jsonURL := XKCDURL + strconv.Itoa(i) + "/info.0.json"
+	resp, err := httpGetHeader(ctx, jsonURL, cond.header()) // "https://xkcd.com/i/info.0.json"
+	if err != nil {
+		return nil, v, false, &NetworkError{URL: jsonURL, Err: err}
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, cond, false, errNotModified
+	case http.StatusNotFound:
+		return nil, v, false, nil
+	default:
+		return nil, v, false, &NetworkError{URL: jsonURL, Status: resp.StatusCode, Err: fmt.Errorf("%s", resp.Status)}
+	}
+
+	// Convert JSON info in HTTP response to byte array
+	respInfo, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, v, false, &NetworkError{URL: jsonURL, Err: err}
+	}
+	if RecordDir != "" {
+		if err := recordInfo(i, respInfo); err != nil {
+			return nil, v, false, err
+		}
+	}
+	if ScrapeTranscripts {
+		respInfo = scrapeFallback(i, respInfo)
+	}
+	return respInfo, validatorOf(resp), true, nil
+}
+
+// GetComic retrieves a single comic from xkcd.com without updating the index
+func GetComic(num int) (Comic, error) {
+	respInfo, err := comicInfo(num)
+	if err != nil {
+		return Comic{}, err
+	}
+	return comicOf(num, respInfo)
+}
+
+// IndexComic retrieves a single comic from xkcd.com like GetComic and
+// stores and indexes it, replacing it if it's already indexed, without
+// running a full update. The index must exist.
+func IndexComic(num int) (Comic, error) {
+	defer flushFailures() // after the database is closed
+	respInfo, err := comicInfo(num)
+	if err != nil {
+		noteFailure(num, "refetch", err)
+		return Comic{}, err
+	}
+	c, err := comicOf(num, respInfo)
+	if err != nil {
+		return Comic{}, err
+	}
+
+	db, err := OpenDB(IndexPath())
+	if err != nil {
+		return Comic{}, fmt.Errorf("db failed to open:\n%s", err)
+	}
+	defer db.Close()
+	if _, _, err := replaceComic(db, num, respInfo); err != nil {
+		noteFailure(num, "refetch", err)
+		return Comic{}, err
+	}
+	return c, nil
+}
+
+// comicInfo downloads the raw JSON info of comic num
+func comicInfo(num int) ([]byte, error) {
+	respInfo, ok, err := fetchInfo(num)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("comic %v not found", num)
+	}
+	return respInfo, nil
+}
+
+// comicOf returns the Comic of comic num's raw JSON info
+func comicOf(num int, respInfo []byte) (Comic, error) {
+	var d LogData
+	if err := json.Unmarshal(respInfo, &d); err != nil {
+		return Comic{}, fmt.Errorf("JSON unmarshalling failed: %s", err)
+	}
+	if d.Link == "" { // 'Link' field is usually empty in json http response
+		d.Link = XKCDURL + strconv.Itoa(num)
+	}
+	return NewComic(d), nil
+}
+
 // viewLogDb returns the 'Index' value (# of docs processed)
 // logged at end of the last execution of the program
-func viewLogDb() int {
+func viewLogDb(ctx context.Context) (int, error) {
 	var index int
-	db, oErr := bolt.Open("log.db", 0766, nil)
+	db, oErr := openDBContext(ctx, LogDBPath(), DBOptions)
 	if oErr != nil {
-		fmt.Printf("db failed to open:\n%s", oErr)
+		return 0, fmt.Errorf("db failed to open:\n%s", oErr)
 	}
 	defer db.Close()
 
+	t := TraceTx("view", "log")
 	vErr := db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("log"))
+		b := tx.Bucket(Bucket("log"))
+		if b == nil { // first update of 'Namespace'
+			index = 1
+			return nil
+		}
 		index = Btoi(b.Get([]byte("index")))
+		t.Get()
 		return nil
 	})
+	t.Done(vErr)
 	if vErr != nil {
-		fmt.Printf("view op failed: %s\n", vErr)
+		return 0, fmt.Errorf("view op failed: %s", vErr)
 	}
-	return index
+	return index, nil
 }
 
-// writeOutput unmashalls data from each http reseponse to Info struct
-// and writes to end of 'comic_log.txt' file
-func writeOutput(f *os.File, respInfo []byte) error {
+// writeOutput appends the JSON info of each http response to the log:
+// as one JSON line, or with 'LegacyLog' unmarshalled to an Info struct
+// and written in its printed form to the end of 'comic_log.txt'
+func writeOutput(respInfo []byte) error {
+	if !LegacyLog {
+		return writeRecord(respInfo)
+	}
+
 	// Unmarshal JSON data to Info struct
 	var comicData *LogData
 	if err := json.Unmarshal(respInfo, &comicData); err != nil {
@@ -192,12 +524,8 @@ func writeOutput(f *os.File, respInfo []byte) error {
 	}
 
 	// Write unmarshalled struct to output file as byte array of string
-	w := bufio.NewWriter(f)
 	e := Entry{Index, comicData}
-	w.Write([]byte(fmt.Sprintf("%v:\t%+v¶\n\n", e.Index, e.Data)))
-	w.Flush()
-
-	return nil
+	return writeLog([]byte(fmt.Sprintf("%v:\t%+v¶\n\n", e.Index, e.Data)))
 }
 
 // formatEntry formats JSON data from http response to be parsed for indexing
@@ -207,22 +535,56 @@ func formatEntry(data []byte) []byte {
 	if err := json.Unmarshal(data, &mapData); err != nil {
 		fmt.Printf("JSON unmarshalling failed: %s\n files written: %v", err, Index)
 	}
-	s := fmt.Sprintf("%v", mapData) // was e.Data
+	return formatMapData(mapData)
+}
 
+// formatMapData formats the fields of MapData to be parsed for indexing,
+// with the HTML of 'News' reduced to its text and URLs, followed by the
+// hostname terms of its URLs
+func formatMapData(mapData *MapData) []byte {
+	if mapData == nil {
+		return nil
+	}
+	m := *mapData
+	m.News = newsText(m.News)
+	formatted := formatText(fmt.Sprintf("%v", &m)) // was e.Data
+	for _, term := range urlTerms(mapData) {
+		formatted = append(formatted, ' ')
+		formatted = append(formatted, term...)
+	}
+	return formatted
+}
+
+// formatText formats text to be parsed for indexing with the
+// tokenization rules in use
+func formatText(s string) []byte {
+	if tokenRules.Transliterate {
+		s = transliterate(s)
+	}
 	// remove & replace non-alpha-numeric characters and lowercase text
-	reg, err := regexp.Compile("[^a-zA-Z0-9]+") // removes all non alpha-numeric characters
-	if err != nil {
-		log.Fatal(err)
+	for i, reg := range replaceRegs {
+		s = reg.ReplaceAllString(s, tokenRules.Replace[i].With)
 	}
-	rmNewln := strings.Replace(s, "\n", "    ", -1)  // replace terms joined by \n with 4 spaces (ex: "boy\nThey" -> "boy", "They")
-	rmApost := strings.Replace(rmNewln, "'", "", -1) // don't split contractions (ex: 'can't' !-> "can", "t")
-	rmComma := strings.Replace(rmApost, ",", "", -1) // don't split numerical values > 999 (ex: 20,000 !-> 20 000)
-	lwr := strings.ToLower(rmComma)
-	formatted := []byte(reg.ReplaceAllString(lwr, " "))
+	lwr := strings.ToLower(s)
+	formatted := []byte(splitReg.ReplaceAllString(lwr, " "))
 
 	return formatted
 }
 
+// Tokenize splits text into the terms it is indexed under
+func Tokenize(s string) []string {
+	return strings.Fields(string(formatText(s)))
+}
+
+// DocTerms returns the unique terms a stored comic is indexed under
+func DocTerms(d LogData) []string {
+	var terms []string
+	for term := range termSet(formatMapData(mapDataOf(d))) {
+		terms = append(terms, term)
+	}
+	return terms
+}
+
 // mapTerms creates an inverted index by mapping each term in each response
 // from xkcd.com to the indexes (DocID) of the documents containing it
 func mapTerms(data []byte) map[string][]int {
@@ -240,8 +602,11 @@ func mapData(data []byte, i int) map[int]LogData {
 	if err := json.Unmarshal(data, &dataMapFields); err != nil {
 		fmt.Printf("JSON unmarshalling failed: %s\n files written: %v", err, Index)
 	}
-	dataMapFields.Link = URL // 'Link' field is empty in json http response
+	if dataMapFields.Link == "" { // 'Link' field is usually empty in json http response
+		dataMapFields.Link = URL
+	}
 	DataMap[i] = *dataMapFields
+	FetchedMap[i] = time.Now()
 
 	return DataMap
 }
@@ -261,7 +626,7 @@ func appendIfUnique(s []int, i int) []int {
 // storeIndexMap stores & updates the inverted index in 'xkcd_index.db' file
 func storeIndexMap(m map[string][]int) error {
 	// open/create db
-	db, err := bolt.Open("xkcd_index.db", 0766, nil)
+	db, err := OpenDB(IndexPath())
 	if err != nil {
 		log.Fatalf("could not open:\n%v", err)
 	}
@@ -269,22 +634,36 @@ func storeIndexMap(m map[string][]int) error {
 
 	// store values and appends to existing keys
 	var i int
+	t := TraceTx("update", "main")
 	uErr := db.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte("main"))
+		b, err := tx.CreateBucketIfNotExists(Bucket("main"))
 		if err != nil {
 			return fmt.Errorf("create 'main' bucket failed:\n%s", err)
 		}
+		if err := InvalidateCache(tx); err != nil {
+			return err
+		}
+		if err := recordTokenRules(tx, t); err != nil {
+			return err
+		}
 
 		for k, v := range m {
-			new := append(b.Get([]byte(k)), Istobs(v)...)
-			err := b.Put([]byte(k), new) // must overwrite old data by appending new to result of b.Get()
+			refs := Bstois(b.Get([]byte(k)))
+			for _, i := range v {
+				refs = insertRef(refs, i) // comics refetched or cached ahead of the update are already listed
+			}
+			new := Istobs(refs)
+			t.Get()
+			err := b.Put([]byte(k), new) // must overwrite old data by merging new into result of b.Get()
 			if err != nil {
 				return fmt.Errorf("put failed:\n%s", err)
 			}
+			t.Put([]byte(k), new)
 			i++
 		}
 		return nil
 	})
+	t.Done(uErr)
 
 	if uErr != nil {
 		return fmt.Errorf("update transaction failed:\n%s", uErr)
@@ -297,7 +676,7 @@ func storeIndexMap(m map[string][]int) error {
 // storeMapData stores & updates LogData as protobuf mapped to index in 'xkcd_index.db' file
 func storeMapData(m map[int]LogData) error {
 	// open db
-	db, err := bolt.Open("xkcd_index.db", 0766, nil)
+	db, err := OpenDB(IndexPath())
 	if err != nil {
 		log.Fatalf("could not open:\n%v", err)
 	}
@@ -305,25 +684,56 @@ func storeMapData(m map[int]LogData) error {
 
 	// map LogData struct to each index
 	var i int
+	t := TraceTx("update", "data")
 	uErr := db.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte("data"))
+		b, err := tx.CreateBucketIfNotExists(Bucket("data"))
 		if err != nil {
 			return fmt.Errorf("create 'data' bucket failed:\n%s", err)
 		}
+		if err := InvalidateCache(tx); err != nil {
+			return err
+		}
+		delta := 0
 		for k, v := range m {
-			err := b.Put(Itob(k), convToProto(v)) // must overwrite old data by appending new to result of b.Get()
+			pb := convToProto(v)
+			delta += NewDoc(v).Len() - docLen(b.Get(Itob(k)))
+			err := b.Put(Itob(k), pb) // must overwrite old data by appending new to result of b.Get()
 			if err != nil {
 				return fmt.Errorf("put failed:\n%s", err)
 			}
+			t.Put(Itob(k), pb)
 			i++
 		}
+		if err := addTotalTerms(tx, delta, t); err != nil {
+			return err
+		}
+
+		// map each title to its index for title searches and record download times
+		tb, err := titleBucket(tx, t)
+		if err != nil {
+			return err
+		}
+		for k, v := range m {
+			if err := putTitle(tb, v.Title, k, t); err != nil {
+				return err
+			}
+			at, ok := FetchedMap[k]
+			if !ok {
+				at = time.Now()
+			}
+			if err := putFetched(tx, k, at, t); err != nil {
+				return err
+			}
+		}
 		return nil
 	})
+	t.Done(uErr)
 
 	if uErr != nil {
 		return fmt.Errorf("update transaction failed:\n%s", uErr)
 	}
 	fmt.Printf("entries stored in 'data': %v\n", i)
+	comicsIndexed(m)
 
 	return nil
 }
@@ -350,16 +760,45 @@ func convToProto(d LogData) []byte {
 	return data
 }
 
+// decodeLogData decodes a LogData struct stored as a protocol buffer
+func decodeLogData(pb []byte) (LogData, error) {
+	o := &LogDataStruct{}
+	if err := proto.Unmarshal(pb, o); err != nil {
+		return LogData{}, fmt.Errorf("proto unmarshal failed: %v", err)
+	}
+	d := LogData{
+		Month:      o.GetMonth(),
+		Num:        o.GetNum(),
+		Link:       o.GetLink(),
+		Year:       o.GetYear(),
+		News:       o.GetNews(),
+		SafeTitle:  o.GetSafeTitle(),
+		Transcript: o.GetTranscript(),
+		Alt:        o.GetAlt(),
+		Img:        o.GetImg(),
+		Title:      o.GetTitle(),
+		Day:        o.GetDay(),
+	}
+	return d, nil
+}
+
+// EncodeLogData encodes a LogData struct as a protocol buffer in the
+// same format used for db storage
+func EncodeLogData(d LogData) []byte {
+	return convToProto(d)
+}
+
 // logIndexVar logs 'Index' (# of http responses processed) for quick lookup next time program runs
 func logIndexVar(i int) error {
-	db, err := bolt.Open("log.db", 0766, nil)
+	db, err := OpenDB(LogDBPath())
 	if err != nil {
 		log.Fatalf("could not open:\n%v", err)
 	}
 	defer db.Close()
 
+	t := TraceTx("update", "log")
 	uErr := db.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte("log"))
+		b, err := tx.CreateBucketIfNotExists(Bucket("log"))
 		if err != nil {
 			return fmt.Errorf("create 'log' bucket failed:\n%s", err)
 		}
@@ -367,8 +806,10 @@ func logIndexVar(i int) error {
 		if pErr != nil {
 			return fmt.Errorf("index log failed:\n%s", err)
 		}
+		t.Put([]byte("index"), Itob(i))
 		return nil
 	})
+	t.Done(uErr)
 
 	if uErr != nil {
 		return fmt.Errorf("log transaction failed:\n%s", err)
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/boltdb/bolt"
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// indexDB is the handle to 'xkcd_index.db' shared by every operation of
+// a single invocation, opened on first use and closed on exit
+var indexDB *bolt.DB
+
+// indexWritable reports whether 'indexDB' was opened for writing
+var indexWritable bool
+
+// openIndex returns the shared handle to 'xkcd_index.db', opening it on
+// first use. The handle is read-only unless write is set; a read-only
+// handle is reopened for writing the first time a write is needed.
+func openIndex(write bool) (*bolt.DB, error) {
+	if indexDB != nil && (indexWritable || !write) {
+		return indexDB, nil
+	}
+	closeIndex()
+	open := xkcd.OpenDBReadOnly
+	if write {
+		open = xkcd.OpenDB
+	}
+	db, err := open(xkcd.IndexPath())
+	if err != nil {
+		return nil, err
+	}
+	indexDB, indexWritable = db, write
+	return db, nil
+}
+
+// closeIndex closes the shared handle. It must be called before exiting
+// and before calling xkcd package functions that open the database
+// themselves, which would otherwise wait on its lock.
+func closeIndex() error {
+	if indexDB == nil {
+		return nil
+	}
+	err := indexDB.Close()
+	indexDB, indexWritable = nil, false
+	return err
+}
+
+// releaseWrite closes the shared handle if it was opened for writing, so
+// a search that wrote to a cache doesn't hold the database's exclusive
+// lock while it reads and prints its results. The next read reopens it
+// read-only.
+func releaseWrite() error {
+	if !indexWritable {
+		return nil
+	}
+	return closeIndex()
+}
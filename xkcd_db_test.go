@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+func TestReleaseWrite(t *testing.T) {
+	dataDir := xkcd.DataDir
+	defer func() { xkcd.DataDir = dataDir }()
+	xkcd.DataDir = t.TempDir()
+	defer closeIndex()
+
+	if _, err := openIndex(true); err != nil {
+		t.Fatal(err)
+	}
+	releaseWrite()
+	if indexDB != nil {
+		t.Fatal("writable handle still open after releaseWrite")
+	}
+
+	db, err := openIndex(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseWrite()
+	if indexDB != db {
+		t.Error("releaseWrite closed a read-only handle")
+	}
+}
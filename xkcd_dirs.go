@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// preparePaths sets the data and cache directories and creates them.
+// Unless 'datadir' was given, files left in the working directory by
+// earlier versions are moved into them first.
+func preparePaths(dataDir, cacheDir string) error {
+	explicit := false
+	flag.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "datadir" })
+	xkcd.DataDir, xkcd.CacheDir = dataDir, cacheDir
+	imageCacheDir = filepath.Join(xkcd.CacheDir, "images")
+	thumbDir = filepath.Join(imageCacheDir, "thumbs")
+
+	moved, err := xkcd.PreparePaths(!explicit)
+	for _, m := range moved {
+		fmt.Fprintf(os.Stderr, "migrated %s\n", m)
+	}
+	if errors.Is(err, xkcd.ErrMigrate) {
+		// the files are still usable where they are, with -datadir
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("prepare data directories failed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package xkcd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/boltdb/bolt"
+)
+
+// TotalTerms returns the total number of terms (see Doc.Len) of the
+// comics in the 'data' bucket, recorded in the 'meta' bucket as they are
+// stored, so scorers can normalize by length without decoding every
+// comic. ok is false for indexes that don't record it yet.
+func TotalTerms(tx *bolt.Tx) (n int, ok bool) {
+	b := tx.Bucket(Bucket("meta"))
+	if b == nil {
+		return 0, false
+	}
+	v := b.Get([]byte("terms"))
+	if v == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(string(v))
+	return n, err == nil
+}
+
+// docLen returns the number of terms of the stored comic record pb, 0 if
+// there is none
+func docLen(pb []byte) int {
+	if pb == nil {
+		return 0
+	}
+	d, err := decodeLogData(pb)
+	if err != nil {
+		return 0
+	}
+	return NewDoc(d).Len()
+}
+
+// addTotalTerms adds delta, the change in length of the comics stored,
+// to the recorded total, or counts every comic if the index doesn't
+// record it yet. It must be called in every transaction that changes
+// the 'data' bucket, after the change.
+func addTotalTerms(tx *bolt.Tx, delta int, t *TxTrace) error {
+	n, ok := TotalTerms(tx)
+	if !ok {
+		return countTotalTerms(tx, t)
+	}
+	return putTotalTerms(tx, n+delta, t)
+}
+
+// countTotalTerms records the total number of terms of every comic in
+// the 'data' bucket
+func countTotalTerms(tx *bolt.Tx, t *TxTrace) error {
+	n := 0
+	if b := tx.Bucket(Bucket("data")); b != nil {
+		b.ForEach(func(_, v []byte) error {
+			t.Get()
+			n += docLen(v)
+			return nil
+		})
+	}
+	return putTotalTerms(tx, n, t)
+}
+
+// putTotalTerms records n as the total number of terms in the 'meta' bucket
+func putTotalTerms(tx *bolt.Tx, n int, t *TxTrace) error {
+	b, err := tx.CreateBucketIfNotExists(Bucket("meta"))
+	if err != nil {
+		return fmt.Errorf("create 'meta' bucket failed:\n%s", err)
+	}
+	v := []byte(strconv.Itoa(n))
+	if err := b.Put([]byte("terms"), v); err != nil {
+		return fmt.Errorf("put failed:\n%s", err)
+	}
+	t.Put([]byte("terms"), v)
+	return nil
+}
@@ -0,0 +1,62 @@
+package xkcd
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+func TestTotalTerms(t *testing.T) {
+	dataDir := DataDir
+	defer func() { DataDir = dataDir }()
+	DataDir = t.TempDir()
+	total := func() int {
+		db, err := OpenDB(IndexPath())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		var n int
+		var ok bool
+		db.View(func(tx *bolt.Tx) error {
+			n, ok = TotalTerms(tx)
+			return nil
+		})
+		if !ok {
+			t.Fatal("total terms not recorded")
+		}
+		return n
+	}
+
+	a := LogData{Num: 1, Title: "Barrel", Alt: "Don't we all.", Year: "2006"}
+	b := LogData{Num: 2, Title: "Petit Trees", Year: "2006"}
+	if err := storeMapData(map[int]LogData{1: a, 2: b}); err != nil {
+		t.Fatal(err)
+	}
+	want := NewDoc(a).Len() + NewDoc(b).Len()
+	if got := total(); got != want {
+		t.Errorf("after storing: total = %v, want %v", got, want)
+	}
+
+	// refetching a comic replaces its length
+	db, err := OpenDB(IndexPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(Bucket("main"))
+		return err
+	})
+	b.Transcript = "a tree of sorts"
+	respInfo, _ := json.Marshal(b)
+	_, _, err = replaceComic(db, 2, respInfo)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = NewDoc(a).Len() + NewDoc(b).Len()
+	if got := total(); got != want {
+		t.Errorf("after refetch: total = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/boltdb/bolt"
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// imageCacheDir is the directory downloaded comic images are cached in,
+// 'images' in 'xkcd.CacheDir'
+var imageCacheDir = filepath.Join(xkcd.CacheDir, "images")
+
+// bucketUsage is the space used by a single bucket
+type bucketUsage struct {
+	Name  string
+	Keys  int
+	Inuse int // bytes used by keys, values and page headers
+	Alloc int // bytes allocated to the bucket's pages
+}
+
+// diskUsage reports per-bucket key counts and sizes, database file
+// sizes, free pages, and the image cache size ('xkcd du')
+func diskUsage(args []string) error {
+	fs := flag.NewFlagSet("du", flag.ExitOnError)
+	fs.Parse(args)
+	if err := checkIndex(); err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(xkcd.IndexPath())
+	if err != nil {
+		return indexErrorf("index not found - run with -u first")
+	}
+	db, err := openIndex(false)
+	if err != nil {
+		return indexErrorf("db failed to open:\n%s", err)
+	}
+
+	var usage []bucketUsage
+	vErr := db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			s := b.Stats()
+			usage = append(usage, bucketUsage{
+				Name:  string(name),
+				Keys:  s.KeyN,
+				Inuse: s.BranchInuse + s.LeafInuse + s.InlineBucketInuse,
+				Alloc: s.BranchAlloc + s.LeafAlloc,
+			})
+			return nil
+		})
+	})
+	if vErr != nil {
+		return fmt.Errorf("view op failed: %w", vErr)
+	}
+	stats := db.Stats()
+
+	fmt.Printf("%-10s\t%8s\t%10s\t%10s\n", "bucket", "keys", "in use", "allocated")
+	for _, u := range usage {
+		fmt.Printf("%-10s\t%8d\t%10s\t%10s\n", u.Name, u.Keys, formatBytes(int64(u.Inuse)), formatBytes(int64(u.Alloc)))
+	}
+	fmt.Println()
+
+	size := fi.Size()
+	fmt.Printf("xkcd_index.db: %s\n", formatBytes(size))
+	free := int64(stats.FreeAlloc)
+	pct := 0.0
+	if size > 0 {
+		pct = float64(free) / float64(size) * 100
+	}
+	fmt.Printf("  free pages: %d (%s, %.1f%% of file)\n", stats.FreePageN+stats.PendingPageN, formatBytes(free), pct)
+	if fi, err := os.Stat(xkcd.LogDBPath()); err == nil {
+		fmt.Printf("log.db: %s\n", formatBytes(fi.Size()))
+	}
+	n, imgSize, err := dirSize(imageCacheDir)
+	if err != nil {
+		return fmt.Errorf("image cache size failed: %v", err)
+	}
+	fmt.Printf("image cache (%s): %d files, %s\n", imageCacheDir, n, formatBytes(imgSize))
+	return nil
+}
+
+// dirSize returns the number and total size of the files under dir,
+// which may not exist
+func dirSize(dir string) (n int, size int64, err error) {
+	err = filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			n++
+			size += fi.Size()
+		}
+		return nil
+	})
+	return n, size, err
+}
+
+// formatBytes formats a size in bytes with a binary unit (ex: '1.5 MiB')
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/boltdb/bolt"
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// exit codes, so scripts can branch on the outcome of a command
+const (
+	exitOK        = 0 // results found / command succeeded
+	exitNoResults = 1 // no results (or any other failure)
+	exitUsage     = 2 // invalid flags or arguments
+	exitIndex     = 3 // index missing or corrupt
+	exitNetwork   = 4 // request to xkcd.com failed
+)
+
+// errNoResults is returned by searches that match no comics
+var errNoResults = errors.New("no results found")
+
+// exitError is an error with the exit code it should end the program with
+type exitError struct {
+	Code int
+	Err  error
+}
+
+func (e *exitError) Error() string { return e.Err.Error() }
+
+func (e *exitError) Unwrap() error { return e.Err }
+
+// usageErrorf returns an error that exits with 'exitUsage'
+func usageErrorf(format string, a ...interface{}) error {
+	return &exitError{exitUsage, fmt.Errorf(format, a...)}
+}
+
+// indexErrorf returns an error that exits with 'exitIndex'
+func indexErrorf(format string, a ...interface{}) error {
+	return &exitError{exitIndex, fmt.Errorf(format, a...)}
+}
+
+// exitCode returns the exit code for err
+func exitCode(err error) int {
+	var ee *exitError
+	var ne *xkcd.NetworkError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &ee):
+		return ee.Code
+	case errors.Is(err, xkcd.ErrNoDatabase):
+		return exitIndex
+	case errors.As(err, &ne):
+		return exitNetwork
+	default:
+		return exitNoResults
+	}
+}
+
+// requireNetwork returns a usage error when command would access the
+// network in offline mode
+func requireNetwork(command string) error {
+	if xkcd.Offline && xkcd.ReplayDir == "" {
+		return usageErrorf("%s needs network access: not available with -offline", command)
+	}
+	return nil
+}
+
+// checkIndex returns an 'exitIndex' error if the index is missing or
+// can't be read, so commands fail before bolt creates an empty database
+func checkIndex() error {
+	if _, err := os.Stat(xkcd.IndexPath()); err != nil {
+		return indexErrorf("index not found - run with -u first")
+	}
+	db, err := openIndex(false)
+	if err != nil {
+		return indexErrorf("db failed to open:\n%s", err)
+	}
+	return db.View(func(tx *bolt.Tx) error {
+		for _, name := range []string{"main", "data"} {
+			if tx.Bucket(xkcd.Bucket(name)) == nil {
+				return indexErrorf("index corrupt: '%s' bucket not found - run with -u first", name)
+			}
+		}
+		if !xkcd.TokenRulesMatch(tx) {
+			fmt.Fprintln(os.Stderr, "warning: index was built with different tokenization rules than the config file's")
+		}
+		return nil
+	})
+}
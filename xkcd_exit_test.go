@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+func TestExitCode(t *testing.T) {
+	missingBucket := indexErrorf("index corrupt: '%s' bucket not found - run with -u first", "data")
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, exitOK},
+		{"no results", errNoResults, exitNoResults},
+		{"other", errors.New("boom"), exitNoResults},
+		{"usage", usageErrorf("invalid comic number: %q", "x"), exitUsage},
+		{"missing bucket", missingBucket, exitIndex},
+		{"missing bucket from view", fmt.Errorf("view op failed: %w", missingBucket), exitIndex},
+		{"missing bucket from update", fmt.Errorf("update transaction failed:\n%w", missingBucket), exitIndex},
+		{"no database", fmt.Errorf("db failed to open:\n%w", xkcd.ErrNoDatabase), exitIndex},
+		{"network", &xkcd.NetworkError{URL: xkcd.XKCDURL, Status: 503, Err: errors.New("503")}, exitNetwork},
+		{"wrapped network", fmt.Errorf("request failed: %w", &xkcd.NetworkError{URL: xkcd.XKCDURL}), exitNetwork},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("%s: exitCode(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestCheckIndexMissing(t *testing.T) {
+	dataDir := xkcd.DataDir
+	defer func() { xkcd.DataDir = dataDir }()
+	xkcd.DataDir = t.TempDir()
+
+	if got := exitCode(checkIndex()); got != exitIndex {
+		t.Errorf("exitCode(checkIndex()) with no index = %v, want %v", got, exitIndex)
+	}
+}
+
+func TestCommandsMissingIndex(t *testing.T) {
+	dataDir := xkcd.DataDir
+	defer func() { xkcd.DataDir = dataDir }()
+	xkcd.DataDir = t.TempDir()
+
+	commands := []struct {
+		name string
+		run  func([]string) error
+		args []string
+	}{
+		{"cluster", clusterComics, nil},
+		{"cooccur", cooccurringTerms, []string{"bitcoin"}},
+		{"get", getComic, []string{"327"}},
+		{"history", searchHistory, nil},
+		{"inspect", inspectComic, []string{"327"}},
+		{"lint", lintIndex, nil},
+		{"periods", periodCounts, nil},
+		{"report", corpusReport, nil},
+		{"sample", sampleData, nil},
+		{"similar", similarComics, []string{"327"}},
+		{"terms", topTerms, nil},
+		{"title", titleLookup, []string{"Exploits of a Mom"}},
+		{"trend", termTrend, []string{"bitcoin"}},
+	}
+	for _, c := range commands {
+		if got := exitCode(c.run(c.args)); got != exitIndex {
+			t.Errorf("%s with no index: exit code = %v, want %v", c.name, got, exitIndex)
+		}
+	}
+	if _, err := os.Stat(xkcd.IndexPath()); !os.IsNotExist(err) {
+		t.Errorf("commands created %s", xkcd.IndexPath())
+	}
+}
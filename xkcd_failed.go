@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/boltdb/bolt"
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// failureCommand lists the recorded failures or clears them once
+// resolved ('xkcd failures -json', 'xkcd failures clear 1234')
+func failureCommand(args []string) error {
+	if len(args) > 0 && args[0] == "clear" {
+		nums, err := parseNums(args[1:])
+		if err != nil {
+			return err
+		}
+		if err := checkIndex(); err != nil {
+			return err
+		}
+		closeIndex() // xkcd.ClearFailures opens the database itself
+		n, err := xkcd.ClearFailures(nums)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("failures cleared: %v\n", n)
+		return nil
+	}
+
+	fs := flag.NewFlagSet("failures", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "write failures as JSON")
+	fs.Parse(args)
+
+	if err := checkIndex(); err != nil {
+		return err
+	}
+	db, err := openIndex(false)
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+	var failures []xkcd.Failure
+	t := xkcd.TraceTx("view", "failures")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		var err error
+		failures, err = xkcd.Failures(tx)
+		t.Get()
+		return err
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		return fmt.Errorf("view op failed: %w", vErr)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(failures); err != nil {
+			return err
+		}
+	} else {
+		for _, f := range failures {
+			status := "-"
+			if f.Status != 0 {
+				status = fmt.Sprint(f.Status)
+			}
+			fmt.Printf("%s\t%-8s\t%5v\t%s\t%s\n", f.Time.Format("2006-01-02 15:04:05"), f.Op, f.Num, status, f.Error)
+		}
+	}
+	if len(failures) == 0 {
+		return errNoResults
+	}
+	return nil
+}
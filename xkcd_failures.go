@@ -0,0 +1,148 @@
+package xkcd
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Failure is a failed fetch or index operation in the 'failures' bucket
+type Failure struct {
+	Num    int       `json:"num,omitempty"` // comic number, 0 for whole-run failures
+	Op     string    `json:"op"`            // fetch, retry, refetch, backfill or update
+	Time   time.Time `json:"time"`
+	Status int       `json:"status,omitempty"` // http status code of the response
+	Error  string    `json:"error"`
+}
+
+// failureLog holds the failures noted since the last flushFailures. It
+// is only written by the goroutine running the update.
+var failureLog []Failure
+
+// noteFailure notes that op failed for comic num with err, to be stored
+// by flushFailures once the database is free
+func noteFailure(num int, op string, err error) {
+	f := Failure{Num: num, Op: op, Time: time.Now(), Error: err.Error()}
+	var netErr *NetworkError
+	if errors.As(err, &netErr) {
+		f.Status = netErr.Status
+	}
+	failureLog = append(failureLog, f)
+}
+
+// flushFailures stores the noted failures in the 'failures' bucket in the
+// order they occurred. Errors are printed, as the operation that failed
+// is already reporting its own outcome.
+func flushFailures() {
+	if len(failureLog) == 0 {
+		return
+	}
+	defer func() { failureLog = nil }()
+	db, err := OpenDB(IndexPath())
+	if err != nil {
+		fmt.Printf("failed to record failures: db failed to open:\n%s\n", err)
+		return
+	}
+	defer db.Close()
+
+	t := TraceTx("update", "failures")
+	uErr := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(Bucket("failures"))
+		if err != nil {
+			return fmt.Errorf("create 'failures' bucket failed:\n%s", err)
+		}
+		for _, f := range failureLog {
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			k := make([]byte, 8)
+			binary.BigEndian.PutUint64(k, seq)
+			v, err := json.Marshal(f)
+			if err != nil {
+				return fmt.Errorf("JSON marshalling failed: %s", err)
+			}
+			if err := b.Put(k, v); err != nil {
+				return fmt.Errorf("put failed:\n%s", err)
+			}
+			t.Put(k, v)
+		}
+		return nil
+	})
+	t.Done(uErr)
+	if uErr != nil {
+		fmt.Printf("failed to record failures: update transaction failed:\n%s\n", uErr)
+	}
+}
+
+// Failures returns the recorded failures, oldest first
+func Failures(tx *bolt.Tx) ([]Failure, error) {
+	b := tx.Bucket(Bucket("failures"))
+	if b == nil {
+		return nil, nil
+	}
+	var fs []Failure
+	err := b.ForEach(func(k, v []byte) error {
+		var f Failure
+		if err := json.Unmarshal(v, &f); err != nil {
+			return fmt.Errorf("JSON unmarshalling failed: %s", err)
+		}
+		fs = append(fs, f)
+		return nil
+	})
+	return fs, err
+}
+
+// ClearFailures deletes the recorded failures of the comics in nums, or
+// every failure when nums is empty, and returns the number deleted
+func ClearFailures(nums []int) (int, error) {
+	db, err := OpenDB(IndexPath())
+	if err != nil {
+		return 0, fmt.Errorf("db failed to open:\n%s", err)
+	}
+	defer db.Close()
+
+	clear := make(map[int]bool)
+	for _, n := range nums {
+		clear[n] = true
+	}
+	var n int
+	t := TraceTx("update", "failures")
+	uErr := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(Bucket("failures"))
+		if b == nil {
+			return nil
+		}
+		var keys [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var f Failure
+			if err := json.Unmarshal(v, &f); err != nil {
+				return fmt.Errorf("JSON unmarshalling failed: %s", err)
+			}
+			if len(nums) == 0 || clear[f.Num] {
+				keys = append(keys, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return fmt.Errorf("delete failed:\n%s", err)
+			}
+			t.Delete()
+		}
+		n = len(keys)
+		return nil
+	})
+	t.Done(uErr)
+	if uErr != nil {
+		return 0, fmt.Errorf("update transaction failed:\n%s", uErr)
+	}
+	return n, nil
+}
@@ -0,0 +1,40 @@
+package xkcd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// FetchedMap stores the time each comic in DataMap was downloaded
+var FetchedMap = make(map[int]time.Time)
+
+// putFetched records the time comic i was downloaded in the 'fetched' bucket
+func putFetched(tx *bolt.Tx, i int, at time.Time, t *TxTrace) error {
+	b, err := tx.CreateBucketIfNotExists(Bucket("fetched"))
+	if err != nil {
+		return fmt.Errorf("create 'fetched' bucket failed:\n%s", err)
+	}
+	v := []byte(at.UTC().Format(time.RFC3339))
+	if err := b.Put(Itob(i), v); err != nil {
+		return fmt.Errorf("put failed:\n%s", err)
+	}
+	t.Put(Itob(i), v)
+	return nil
+}
+
+// FetchedAt returns the time comic i was last downloaded. ok is false
+// for comics stored before download times were recorded.
+func FetchedAt(tx *bolt.Tx, i int) (at time.Time, ok bool) {
+	b := tx.Bucket(Bucket("fetched"))
+	if b == nil {
+		return at, false
+	}
+	v := b.Get(Itob(i))
+	if v == nil {
+		return at, false
+	}
+	at, err := time.Parse(time.RFC3339, string(v))
+	return at, err == nil
+}
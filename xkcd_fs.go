@@ -0,0 +1,156 @@
+package xkcd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"time"
+)
+
+// File is an open file of an 'FS'
+type File interface {
+	io.Reader
+	io.Writer
+	io.Closer
+	Sync() error
+}
+
+// FS is the filesystem the comic log, its segments, the data directories
+// and captured responses are accessed through, so every file operation
+// outside BoltDB behaves the same on Windows and network filesystems.
+// The databases themselves are opened by BoltDB, which takes its own lock.
+type FS interface {
+	Open(name string) (File, error)
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	Stat(name string) (os.FileInfo, error)
+	ReadDir(dir string) ([]os.FileInfo, error)
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	MkdirAll(path string, perm os.FileMode) error
+
+	// Lock takes the advisory lock guarding name, waiting up to
+	// 'DBOptions.Timeout' (0 waits indefinitely), and returns the
+	// function releasing it
+	Lock(name string) (unlock func() error, err error)
+
+	// SyncDir commits the entries of dir, such as renames, to disk
+	SyncDir(dir string) error
+}
+
+// Files is the filesystem used by the package
+var Files FS = OSFS{}
+
+// staleLock is the age after which a lock file is assumed to be left
+// behind by a crashed process. Locks are only held while a log record is
+// written or the log is rotated or read.
+const staleLock = time.Minute
+
+// OSFS is the 'FS' of the operating system. Its locks are lock files
+// created exclusively next to the locked file, which unlike flock(2)
+// work the same on Windows and on NFS and SMB mounts.
+type OSFS struct{}
+
+// Open opens name for reading
+func (OSFS) Open(name string) (File, error) { return os.Open(name) }
+
+// OpenFile opens name with flag and perm as os.OpenFile does
+func (OSFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+// Stat returns the FileInfo of name
+func (OSFS) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
+
+// ReadDir returns the entries of dir sorted by name
+func (OSFS) ReadDir(dir string) ([]os.FileInfo, error) { return ioutil.ReadDir(dir) }
+
+// Rename renames oldpath to newpath, replacing newpath on every platform
+func (OSFS) Rename(oldpath, newpath string) error { return os.Rename(oldpath, newpath) }
+
+// Remove removes name
+func (OSFS) Remove(name string) error { return os.Remove(name) }
+
+// MkdirAll creates path and any missing parents
+func (OSFS) MkdirAll(path string, perm os.FileMode) error { return os.MkdirAll(path, perm) }
+
+// Lock creates 'name.lock' exclusively, retrying while another process
+// holds it. A lock file older than 'staleLock' is removed, see breakLock.
+func (OSFS) Lock(name string) (func() error, error) {
+	lock := name + ".lock"
+	start := time.Now()
+	for {
+		f, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() error { return os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if fi, err := os.Stat(lock); err == nil && time.Since(fi.ModTime()) > staleLock {
+			breakLock(lock, fi) // left by a crashed process
+			continue
+		}
+		if DBOptions.Timeout > 0 && time.Since(start) > DBOptions.Timeout {
+			return nil, fmt.Errorf("timeout waiting for %s", lock)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// breakLock removes the stale lock file with FileInfo stale. Another
+// process may have broken it and taken the lock since it was found, so
+// the file is first renamed aside, atomically, and only removed if it's
+// still the stale one; a live lock renamed by mistake is linked back.
+func breakLock(lock string, stale os.FileInfo) {
+	aside := fmt.Sprintf("%s.stale.%d", lock, os.Getpid())
+	if err := os.Rename(lock, aside); err != nil {
+		return // already broken
+	}
+	fi, err := os.Stat(aside)
+	if err == nil && (!os.SameFile(fi, stale) || !fi.ModTime().Equal(stale.ModTime())) {
+		os.Link(aside, lock) // fails if the lock was taken again
+	}
+	os.Remove(aside)
+}
+
+// SyncDir fsyncs dir. Windows can't open directories for syncing and
+// commits renames itself, and some network filesystems reject directory
+// fsync, so it is best effort: only failing to open dir is an error.
+func (OSFS) SyncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	d.Sync()
+	return d.Close()
+}
+
+// readFile reads the whole of name from 'Files'
+func readFile(name string) ([]byte, error) {
+	f, err := Files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// writeFile writes data to name in 'Files', replacing its contents
+func writeFile(name string, data []byte, perm os.FileMode) error {
+	f, err := Files.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
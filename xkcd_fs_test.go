@@ -0,0 +1,60 @@
+package xkcd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLockBreaksStaleLock(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "comic_log.jsonl")
+	lock := name + ".lock"
+	if err := ioutil.WriteFile(lock, []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * staleLock)
+	if err := os.Chtimes(lock, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err := OSFS{}.Lock(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(lock); err != nil || time.Since(fi.ModTime()) > staleLock {
+		t.Errorf("lock file not replaced: %v", err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// a lock broken and taken again by another process after it was found
+// stale must survive
+func TestBreakLockKeepsLiveLock(t *testing.T) {
+	lock := filepath.Join(t.TempDir(), "comic_log.jsonl.lock")
+	if err := ioutil.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	stale, err := os.Stat(lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(lock, lock+".old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(lock, []byte("live"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	breakLock(lock, stale)
+	if b, err := ioutil.ReadFile(lock); err != nil || string(b) != "live" {
+		t.Errorf("live lock removed: %q, %v", b, err)
+	}
+	if _, err := os.Stat(lock + ".stale." + strconv.Itoa(os.Getpid())); !os.IsNotExist(err) {
+		t.Errorf("renamed lock left behind: %v", err)
+	}
+}
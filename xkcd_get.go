@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// explainURL is the prefix of each comic's explainxkcd.com page
+const explainURL = "https://www.explainxkcd.com/wiki/index.php/"
+
+// comicRecord is a stored comic with its derived fields, as printed by 'xkcd get'
+type comicRecord struct {
+	Num          int32              `json:"num"`
+	Title        string             `json:"title"`
+	SafeTitle    string             `json:"safe_title"`
+	Date         string             `json:"date"`
+	Year         string             `json:"year"`
+	Month        string             `json:"month"`
+	Day          string             `json:"day"`
+	Alt          string             `json:"alt"`
+	Transcript   string             `json:"transcript"`
+	News         string             `json:"news"`
+	Img          string             `json:"img"`
+	Link         string             `json:"link"`
+	ExplainLink  string             `json:"explain_link"`
+	FetchedAt    *time.Time         `json:"fetched_at,omitempty"`
+	Translations []xkcd.Translation `json:"translations,omitempty"`
+}
+
+// newComicRecord adds the derived fields to stored comic d
+func newComicRecord(d xkcd.LogData, fetchedAt *time.Time) comicRecord {
+	return comicRecord{
+		Num:         d.Num,
+		Title:       d.Title,
+		SafeTitle:   d.SafeTitle,
+		Date:        comicDate(d),
+		Year:        d.Year,
+		Month:       d.Month,
+		Day:         d.Day,
+		Alt:         d.Alt,
+		Transcript:  d.Transcript,
+		News:        d.News,
+		Img:         d.Img,
+		Link:        d.Link,
+		ExplainLink: explainURL + strconv.Itoa(int(d.Num)),
+		FetchedAt:   fetchedAt,
+	}
+}
+
+// getComic prints the stored record of a single comic, first downloading
+// and indexing it with 'fetch' ('xkcd get 927 --json', 'xkcd get 2900 --fetch')
+func getComic(args []string) error {
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print record as JSON")
+	fetch := fs.Bool("fetch", false, "download the comic from xkcd.com and store and index it first")
+	pos := parseArgs(fs, args)
+
+	if len(pos) != 1 {
+		return usageErrorf("usage: xkcd get <num> [--json] [--fetch]")
+	}
+	num, err := strconv.Atoi(pos[0])
+	if err != nil {
+		return usageErrorf("invalid comic number: %q", pos[0])
+	}
+	if *fetch {
+		if err := requireNetwork("get -fetch"); err != nil {
+			return err
+		}
+	}
+	if err := checkIndex(); err != nil {
+		return err
+	}
+	if *fetch {
+		closeIndex()
+		if _, err := xkcd.IndexComic(num); err != nil {
+			return fmt.Errorf("fetch %v failed: %w", num, err)
+		}
+	}
+	return showComic(num, *asJSON)
+}
+
+// showComic prints the stored record of comic num, as JSON with asJSON
+func showComic(num int, asJSON bool) error {
+	db, err := openIndex(false)
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+
+	var rec comicRecord
+	t := xkcd.TraceTx("view", "data")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(xkcd.Bucket("data"))
+		if b == nil {
+			return indexErrorf("data index not found - run with -u first")
+		}
+		v := b.Get(xkcd.Itob(num))
+		t.Get()
+		if v == nil {
+			return fmt.Errorf("comic %v not indexed", num)
+		}
+		var fetchedAt *time.Time
+		if at, ok := xkcd.FetchedAt(tx, num); ok {
+			fetchedAt = &at
+		}
+		rec = newComicRecord(decodeProto(v), fetchedAt)
+		rec.Translations = xkcd.Translations(tx, num)
+		return nil
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		return vErr
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rec)
+	}
+	fmt.Printf("Num: %d\nTitle: %s\nDate: %s\nAlt: %s\nTranscript: %s\nImg: %s\nLink: %s\nExplain: %s\n",
+		rec.Num, rec.Title, rec.Date, rec.Alt, rec.Transcript, rec.Img, rec.Link, rec.ExplainLink)
+	if rec.FetchedAt != nil {
+		fmt.Printf("Fetched: %s\n", rec.FetchedAt.Local().Format(time.RFC1123))
+	}
+	for _, tl := range rec.Translations {
+		fmt.Printf("Title (%s): %s\nAlt (%s): %s\n", tl.Lang, tl.Title, tl.Lang, tl.Alt)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// logHistory enables recording of each search in the 'history' bucket
+var logHistory = true
+
+// historyKey orders 'history' entries by time of search
+const historyKey = "2006-01-02T15:04:05.000000000Z"
+
+// historyEntry is a single executed search
+type historyEntry struct {
+	Time  time.Time `json:"time"`
+	Query string    `json:"query"`
+	Hits  int       `json:"hits"`
+}
+
+// logQuery records a search and its hit count in the 'history' bucket
+func logQuery(text string, hits int) error {
+	if !logHistory {
+		return nil
+	}
+	db, err := openIndex(true)
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+
+	e := historyEntry{time.Now().UTC(), strings.Join(strings.Fields(text), " "), hits}
+	k := []byte(e.Time.Format(historyKey))
+	v, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("JSON marshalling failed: %s", err)
+	}
+	t := xkcd.TraceTx("update", "history")
+	uErr := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(xkcd.Bucket("history"))
+		if err != nil {
+			return fmt.Errorf("create 'history' bucket failed:\n%s", err)
+		}
+		t.Put(k, v)
+		return b.Put(k, v)
+	})
+	t.Done(uErr)
+	if uErr != nil {
+		return fmt.Errorf("update transaction failed:\n%w", uErr)
+	}
+	return nil
+}
+
+// readHistory returns every entry in the 'history' bucket, oldest first
+func readHistory() ([]historyEntry, error) {
+	db, err := openIndex(false)
+	if err != nil {
+		return nil, fmt.Errorf("db failed to open:\n%s", err)
+	}
+
+	var entries []historyEntry
+	t := xkcd.TraceTx("view", "history")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(xkcd.Bucket("history"))
+		if b == nil {
+			return nil // no searches logged yet
+		}
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var e historyEntry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return fmt.Errorf("JSON unmarshalling failed: %s", err)
+			}
+			entries = append(entries, e)
+			t.Get()
+		}
+		return nil
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		return nil, fmt.Errorf("view op failed: %w", vErr)
+	}
+	return entries, nil
+}
+
+// searchHistory lists the most recent searches, or re-runs one of them
+// by its number in the list ('xkcd history -n 20', 'xkcd history -run 3')
+func searchHistory(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	n := fs.Int("n", 20, "number of recent searches to list")
+	run := fs.Int("run", 0, "re-run search `number` from the list")
+	fs.Parse(args)
+
+	if err := checkIndex(); err != nil {
+		return err
+	}
+	entries, err := readHistory()
+	if err != nil {
+		return err
+	}
+	if *run > 0 {
+		if *run > len(entries) {
+			return fmt.Errorf("no search #%v in history", *run)
+		}
+		e := entries[*run-1]
+		fmt.Printf("search query: %s\n", e.Query)
+		return runSearch(e.Query)
+	}
+
+	first := 0
+	if *n > 0 && len(entries) > *n {
+		first = len(entries) - *n
+	}
+	for i, e := range entries[first:] {
+		fmt.Printf("%4d\t%s\t%5d hits\t%s\n",
+			first+i+1, e.Time.Local().Format("2006-01-02 15:04:05"), e.Hits, e.Query)
+	}
+	fmt.Printf("\nTotal searches: %v\n", len(entries))
+	return nil
+}
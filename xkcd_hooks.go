@@ -0,0 +1,117 @@
+package xkcd
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Hooks are called at points of updates and searches, so embedding
+// applications can add metrics, caching or notifications without forking
+// the indexing loop. Any field may be nil. Backfills, and updates with
+// more than one 'FetchWorkers', download comics concurrently, so the
+// fetch hooks must be safe for concurrent use.
+type Hooks struct {
+	OnFetchStart     func(num int)                  // before comic num is downloaded or replayed
+	OnComicFetched   func(num int, respInfo []byte) // with the raw JSON info of each downloaded comic
+	OnComicIndexed   func(c Comic)                  // once a comic is stored in the index
+	OnProgress       func(p Progress)               // after each comic an update downloads, skips or fails
+	OnUpdateComplete func(s RunSummary)             // with the summary of each update, failed or not
+	OnSearch         func(query string, refs []int) // with the DocIDs each search matched
+}
+
+var (
+	hooksMu sync.RWMutex
+	hooks   []Hooks
+)
+
+// RegisterHooks adds h to the hooks called by the package. Hooks are
+// called in the order they were registered.
+func RegisterHooks(h Hooks) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = append(hooks, h)
+}
+
+// Progress is the state of an update after it processes a comic, for
+// host applications rendering status
+type Progress struct {
+	Num     int           // comic just processed
+	Done    int           // comics processed so far: fetched, skipped or failed
+	Total   int           // comics the update expects to process
+	Fetched int           // comics downloaded and mapped so far
+	Failed  int           // comics that failed to download so far
+	Err     error         // why comic Num failed, nil if it was fetched or skipped
+	Elapsed time.Duration // time since the update started
+}
+
+// registered returns the registered hooks
+func registered() []Hooks {
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	return hooks
+}
+
+func fetchStarted(num int) {
+	for _, h := range registered() {
+		if h.OnFetchStart != nil {
+			h.OnFetchStart(num)
+		}
+	}
+}
+
+func comicFetched(num int, respInfo []byte) {
+	for _, h := range registered() {
+		if h.OnComicFetched != nil {
+			h.OnComicFetched(num, respInfo)
+		}
+	}
+}
+
+// comicsIndexed calls the OnComicIndexed hooks for the comics of m in
+// DocID order
+func comicsIndexed(m map[int]LogData) {
+	hs := registered()
+	if len(hs) == 0 {
+		return
+	}
+	nums := make([]int, 0, len(m))
+	for num := range m {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		for _, h := range hs {
+			if h.OnComicIndexed != nil {
+				h.OnComicIndexed(NewComic(m[num]))
+			}
+		}
+	}
+}
+
+func progressed(p Progress) {
+	for _, h := range registered() {
+		if h.OnProgress != nil {
+			h.OnProgress(p)
+		}
+	}
+}
+
+func updateCompleted(s RunSummary) {
+	for _, h := range registered() {
+		if h.OnUpdateComplete != nil {
+			h.OnUpdateComplete(s)
+		}
+	}
+}
+
+// Searched calls the OnSearch hooks with a search's query and the DocIDs
+// it matched. 'Search' calls it itself; the command runs its own
+// searches and calls it once each completes.
+func Searched(query string, refs []int) {
+	for _, h := range registered() {
+		if h.OnSearch != nil {
+			h.OnSearch(query, refs)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/boltdb/bolt"
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// cachedImage is the record of a comic image in the image cache
+type cachedImage struct {
+	URL    string `json:"url"`
+	File   string `json:"file"` // path relative to 'imageCacheDir'
+	SHA256 string `json:"sha256"`
+}
+
+// imageFile returns the cache file name of comic num's image url
+func imageFile(num int, url string) string {
+	return strconv.Itoa(num) + "-" + path.Base(url)
+}
+
+// imageCommand runs an image cache subcommand ('xkcd images verify',
+// 'xkcd images thumbs')
+func imageCommand(args []string) error {
+	if len(args) == 0 {
+		return usageErrorf("usage: xkcd images verify [-dry] | thumbs [-width <px>] [-force]")
+	}
+	switch args[0] {
+	case "verify":
+		return verifyImages(args[1:])
+	case "thumbs":
+		return generateThumbs(args[1:])
+	default:
+		return usageErrorf("unknown images command: %q", args[0])
+	}
+}
+
+// verifyImages checks that every stored comic's image is cached in
+// 'imageCacheDir' with the checksum recorded in the 'images' bucket, and
+// re-downloads missing or corrupt images unless -dry is set
+func verifyImages(args []string) error {
+	fs := flag.NewFlagSet("images verify", flag.ExitOnError)
+	dry := fs.Bool("dry", false, "report missing and corrupt images without downloading them")
+	fs.Parse(args)
+	if !*dry {
+		if err := requireNetwork("images verify"); err != nil {
+			return err
+		}
+	}
+	if err := checkIndex(); err != nil {
+		return err
+	}
+
+	db, err := openIndex(false)
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+	comics := make(map[int]string) // DocID: Img URL
+	records := make(map[int]cachedImage)
+	err = eachComic(db, func(d xkcd.LogData) {
+		if d.Img != "" {
+			comics[int(d.Num)] = d.Img
+		}
+	})
+	if err != nil {
+		return err
+	}
+	t := xkcd.TraceTx("view", "images")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(xkcd.Bucket("images"))
+		if b == nil {
+			return nil // nothing cached yet
+		}
+		return b.ForEach(func(k, v []byte) error {
+			t.Get()
+			var r cachedImage
+			if err := json.Unmarshal(v, &r); err != nil {
+				return fmt.Errorf("JSON unmarshalling failed: %s", err)
+			}
+			records[xkcd.Btoi(k)] = r
+			return nil
+		})
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		return fmt.Errorf("view op failed: %w", vErr)
+	}
+
+	var nums []int
+	for num := range comics {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	var ok, missing, corrupt, failed int
+	repaired := make(map[int]cachedImage)
+	for _, num := range nums {
+		url := comics[num]
+		r, stored := records[num]
+		if stored && r.URL == url {
+			sum, err := fileSHA256(filepath.Join(imageCacheDir, r.File))
+			switch {
+			case err == nil && sum == r.SHA256:
+				ok++
+				continue
+			case os.IsNotExist(err):
+				missing++
+				fmt.Printf("missing: %v %s\n", num, r.File)
+			default:
+				corrupt++
+				fmt.Printf("corrupt: %v %s\n", num, r.File)
+			}
+		} else {
+			missing++
+			fmt.Printf("missing: %v %s\n", num, url)
+		}
+		if *dry {
+			continue
+		}
+		r, err := downloadImage(num, url)
+		if err != nil {
+			failed++
+			fmt.Printf("download failed: %v (%v)\n", num, err)
+			continue
+		}
+		repaired[num] = r
+		if err := makeThumb(num, filepath.Join(imageCacheDir, r.File)); err != nil {
+			fmt.Printf("thumbnail failed: %v (%v)\n", num, err)
+		}
+	}
+
+	if len(repaired) > 0 {
+		if err := storeImages(repaired); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("\nimages ok: %v, missing: %v, corrupt: %v, downloaded: %v, failed: %v\n",
+		ok, missing, corrupt, len(repaired), failed)
+	return nil
+}
+
+// httpGet requests url with 'xkcd.Client', so the command's downloads
+// use the same proxy, timeouts and headers as the package's requests
+func httpGet(url string) (*http.Response, error) {
+	if xkcd.Offline {
+		return nil, xkcd.ErrOffline
+	}
+	req, err := xkcd.NewRequest(context.Background(), http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return xkcd.Client.Do(req)
+}
+
+// downloadImage downloads comic num's image from url into 'imageCacheDir'
+func downloadImage(num int, url string) (cachedImage, error) {
+	r := cachedImage{URL: url, File: imageFile(num, url)}
+	resp, err := httpGet(url)
+	if err != nil {
+		return r, &xkcd.NetworkError{URL: url, Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return r, &xkcd.NetworkError{URL: url, Status: resp.StatusCode, Err: fmt.Errorf("%s", resp.Status)}
+	}
+	img, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return r, &xkcd.NetworkError{URL: url, Err: err}
+	}
+	if err := os.MkdirAll(imageCacheDir, 0766); err != nil {
+		return r, fmt.Errorf("create image cache failed: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(imageCacheDir, r.File), img, 0666); err != nil {
+		return r, fmt.Errorf("image write failed: %v", err)
+	}
+	sum := sha256.Sum256(img)
+	r.SHA256 = hex.EncodeToString(sum[:])
+	return r, nil
+}
+
+// storeImages records cached images in the 'images' bucket
+func storeImages(m map[int]cachedImage) error {
+	db, err := openIndex(true)
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+	t := xkcd.TraceTx("update", "images")
+	uErr := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(xkcd.Bucket("images"))
+		if err != nil {
+			return fmt.Errorf("create 'images' bucket failed:\n%s", err)
+		}
+		for num, r := range m {
+			v, err := json.Marshal(r)
+			if err != nil {
+				return fmt.Errorf("JSON marshalling failed: %s", err)
+			}
+			if err := b.Put(xkcd.Itob(num), v); err != nil {
+				return fmt.Errorf("put failed:\n%s", err)
+			}
+			t.Put(xkcd.Itob(num), v)
+		}
+		return nil
+	})
+	t.Done(uErr)
+	if uErr != nil {
+		return fmt.Errorf("update transaction failed:\n%w", uErr)
+	}
+	return nil
+}
+
+// fileSHA256 returns the hex SHA-256 checksum of the file at name
+func fileSHA256(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// searchSources are the namespaces searched with -source (empty
+// searches the -index namespace only)
+var searchSources []string
+
+// feed is an RSS or Atom feed; only the fields of one format are set
+type feed struct {
+	Items   []feedItem  `xml:"channel>item"` // RSS
+	Entries []feedEntry `xml:"entry"`        // Atom
+}
+
+type feedItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	Content     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PubDate     string `xml:"pubDate"`
+}
+
+type feedEntry struct {
+	Title string `xml:"title"`
+	Link  struct {
+		Href string `xml:"href,attr"`
+	} `xml:"link"`
+	Summary string `xml:"summary"`
+	Content string `xml:"content"`
+	Updated string `xml:"updated"`
+}
+
+// importDocuments indexes documents from another corpus in the namespace
+// named by -source: the posts of an RSS or Atom feed, or local text
+// files ('xkcd import -source whatif -feed https://what-if.xkcd.com/feed.atom',
+// 'xkcd import -source notes *.txt'). Documents already imported, by
+// link, are skipped.
+func importDocuments(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	source := fs.String("source", "", "namespace to import into (ex: whatif, blag, notes)")
+	feedURL := fs.String("feed", "", "import the posts of the RSS or Atom feed at `url`")
+	files := parseArgs(fs, args)
+	if *source == "" || *source == xkcd.DefaultNamespace || strings.Contains(*source, "/") {
+		return usageErrorf("usage: xkcd import -source <name> [-feed <url>] [file...]")
+	}
+	if *feedURL == "" && len(files) == 0 {
+		return usageErrorf("usage: xkcd import -source <name> [-feed <url>] [file...]")
+	}
+
+	var docs []xkcd.Document
+	if *feedURL != "" {
+		if err := requireNetwork("import -feed"); err != nil {
+			return err
+		}
+		d, err := fetchFeed(*feedURL)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, d...)
+	}
+	for _, f := range files {
+		d, err := readDocument(f)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, d)
+	}
+
+	xkcd.Namespace = *source
+	seen, err := importedLinks()
+	if err != nil {
+		return err
+	}
+	closeIndex() // xkcd.AddDocuments opens the database itself
+	var added []xkcd.Document
+	for _, d := range docs {
+		if !seen[d.Link] {
+			seen[d.Link] = true
+			added = append(added, d)
+		}
+	}
+	ids, err := xkcd.AddDocuments(added)
+	if err != nil {
+		return fmt.Errorf("import failed: %v", err)
+	}
+	fmt.Printf("documents imported into '%s': %v (%v already indexed)\n", *source, len(ids), len(docs)-len(ids))
+	return nil
+}
+
+// importedLinks returns the links of the documents in the current namespace
+func importedLinks() (map[string]bool, error) {
+	seen := make(map[string]bool)
+	if _, err := os.Stat(xkcd.IndexPath()); err != nil {
+		return seen, nil
+	}
+	db, err := openIndex(false)
+	if err != nil {
+		return nil, fmt.Errorf("db failed to open:\n%s", err)
+	}
+	vErr := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(xkcd.Bucket("data"))
+		if b == nil { // nothing imported yet
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			seen[decodeProto(v).Link] = true
+			return nil
+		})
+	})
+	if vErr != nil {
+		return nil, fmt.Errorf("view op failed: %w", vErr)
+	}
+	return seen, nil
+}
+
+// fetchFeed downloads the RSS or Atom feed at url as documents
+func fetchFeed(url string) ([]xkcd.Document, error) {
+	resp, err := httpGet(url)
+	if err != nil {
+		return nil, &xkcd.NetworkError{URL: url, Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &xkcd.NetworkError{URL: url, Status: resp.StatusCode, Err: fmt.Errorf("%s", resp.Status)}
+	}
+	var f feed
+	if err := xml.NewDecoder(resp.Body).Decode(&f); err != nil {
+		return nil, fmt.Errorf("feed parsing failed: %v", err)
+	}
+
+	var docs []xkcd.Document
+	for _, it := range f.Items {
+		text := it.Content
+		if text == "" {
+			text = it.Description
+		}
+		date, _ := time.Parse(time.RFC1123Z, it.PubDate)
+		docs = append(docs, xkcd.Document{Title: it.Title, Text: stripTags(text), Link: it.Link, Date: date})
+	}
+	for _, e := range f.Entries {
+		text := e.Content
+		if text == "" {
+			text = e.Summary
+		}
+		date, _ := time.Parse(time.RFC3339, e.Updated)
+		docs = append(docs, xkcd.Document{Title: e.Title, Text: stripTags(text), Link: e.Link.Href, Date: date})
+	}
+	return docs, nil
+}
+
+// readDocument reads a local text file as a document titled with its
+// first non-empty line
+func readDocument(path string) (xkcd.Document, error) {
+	var d xkcd.Document
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return d, fmt.Errorf("read failed: %v", err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return d, fmt.Errorf("read failed: %v", err)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return d, fmt.Errorf("read failed: %v", err)
+	}
+	d = xkcd.Document{Title: filepath.Base(path), Text: string(b), Link: "file://" + abs, Date: fi.ModTime()}
+	s := bufio.NewScanner(strings.NewReader(d.Text))
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" {
+			d.Title = line
+			break
+		}
+	}
+	return d, nil
+}
+
+// stripTags removes HTML tags from s, leaving its text
+func stripTags(s string) string {
+	var b strings.Builder
+	inTag := false
+	for _, r := range s {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>' && inTag:
+			inTag = false
+			b.WriteRune(' ')
+		case !inTag:
+			b.WriteRune(r)
+		}
+	}
+	return strings.Join(strings.Fields(html.UnescapeString(b.String())), " ")
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/boltdb/bolt"
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// posting is a posting list entry referencing a DocID
+type posting struct {
+	Term string
+	Pos  int // position of the DocID in the term's posting list
+	Len  int // length of the posting list
+}
+
+// inspectComic prints everything the index stores about a single comic
+// for debugging: the decoded record, its title key and the posting list
+// entries referencing its DocID, and with 'raw' the stored protobuf
+// bytes and the original JSON retained in the log ('xkcd inspect 1234 --raw')
+func inspectComic(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	raw := fs.Bool("raw", false, "also print the stored protobuf bytes as hex and the original JSON from the log")
+	pos := parseArgs(fs, args)
+
+	if len(pos) != 1 {
+		return usageErrorf("usage: xkcd inspect <num> [--raw]")
+	}
+	num, err := strconv.Atoi(pos[0])
+	if err != nil {
+		return usageErrorf("invalid comic number: %q", pos[0])
+	}
+
+	if err := checkIndex(); err != nil {
+		return err
+	}
+	db, err := openIndex(false)
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+
+	var pb []byte
+	var titleKey string
+	var postings []posting
+	t := xkcd.TraceTx("view", "main")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		data, main := tx.Bucket(xkcd.Bucket("data")), tx.Bucket(xkcd.Bucket("main"))
+		if data == nil || main == nil {
+			return indexErrorf("index not found - run with -u first")
+		}
+		v := data.Get(xkcd.Itob(num))
+		t.Get()
+		if v == nil {
+			return fmt.Errorf("comic %v not indexed", num)
+		}
+		pb = append([]byte(nil), v...)
+
+		if tb := tx.Bucket(xkcd.Bucket("title")); tb != nil {
+			tb.ForEach(func(k, v []byte) error {
+				t.Get()
+				for _, ref := range xkcd.Bstois(v) {
+					if ref == num {
+						titleKey = string(k)
+					}
+				}
+				return nil
+			})
+		}
+		return main.ForEach(func(k, v []byte) error {
+			t.Get()
+			refs := xkcd.Bstois(v)
+			for i, ref := range refs {
+				if ref == num {
+					postings = append(postings, posting{string(k), i, len(refs)})
+					break
+				}
+			}
+			return nil
+		})
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		return vErr
+	}
+	sort.Slice(postings, func(i, j int) bool { return postings[i].Term < postings[j].Term })
+
+	fmt.Printf("DocID: %d (key %x)\n", num, xkcd.Itob(num))
+	if *raw {
+		fmt.Printf("\n--- protobuf (%d bytes) ---\n%s", len(pb), hex.Dump(pb))
+	}
+	fmt.Printf("\n--- decoded ---\n%+v\n", decodeProto(pb))
+	if *raw {
+		fmt.Printf("\n--- original JSON ---\n")
+		info, ok, err := xkcd.LoggedInfo(num)
+		switch {
+		case err != nil:
+			fmt.Printf("read %s failed: %v\n", xkcd.LogFile(), err)
+		case !ok:
+			fmt.Printf("not retained in %s\n", xkcd.LogFile())
+		default:
+			var out bytes.Buffer
+			if json.Indent(&out, info, "", "  ") != nil {
+				out.Reset()
+				out.Write(info)
+			}
+			fmt.Println(out.String())
+		}
+	}
+	fmt.Printf("\n--- title key ---\n%q\n", titleKey)
+	fmt.Printf("\n--- postings (%d terms) ---\n", len(postings))
+	for _, p := range postings {
+		fmt.Printf("%s\t[%d/%d]\n", p.Term, p.Pos+1, p.Len)
+	}
+	return nil
+}
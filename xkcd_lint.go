@@ -0,0 +1,131 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/boltdb/bolt"
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// lintReport counts the problems found in the inverted index
+type lintReport struct {
+	Terms      int
+	Duplicates int // terms with a DocID listed more than once
+	Unsorted   int // terms with DocIDs out of order
+	Empty      int // terms with zero-length lists
+	Orphaned   int // terms whose DocIDs have no entry in 'data'
+}
+
+// lintIndex scans each posting list in the inverted index for problems
+// and optionally repairs them in place ('xkcd lint --fix')
+func lintIndex(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	fix := fs.Bool("fix", false, "repair problems in place")
+	fs.Parse(args)
+
+	if err := checkIndex(); err != nil {
+		return err
+	}
+	db, err := openIndex(*fix)
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+
+	var r lintReport
+	repairs := make(map[string][]int) // term: repaired list (nil deletes term)
+	t := xkcd.TraceTx("view", "main")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(xkcd.Bucket("data"))
+		b := tx.Bucket(xkcd.Bucket("main"))
+		if b == nil || data == nil {
+			return indexErrorf("index not found - run with -u first")
+		}
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			r.Terms++
+			t.Get()
+			refs := xkcd.Bstois(v)
+			if len(refs) == 0 {
+				r.Empty++
+				repairs[string(k)] = nil
+				continue
+			}
+
+			dup, unsorted := false, false
+			seen := make(map[int]bool)
+			var clean []int
+			for i, ref := range refs {
+				if seen[ref] {
+					dup = true
+					continue
+				}
+				if i > 0 && ref < refs[i-1] {
+					unsorted = true
+				}
+				seen[ref] = true
+				if data.Get(xkcd.Itob(ref)) != nil {
+					clean = append(clean, ref)
+				}
+			}
+			if dup {
+				r.Duplicates++
+			}
+			if unsorted {
+				r.Unsorted++
+			}
+			if len(clean) == 0 {
+				r.Orphaned++
+				repairs[string(k)] = nil
+				continue
+			}
+			if dup || unsorted || len(clean) != len(seen) {
+				sort.Ints(clean)
+				repairs[string(k)] = clean
+			}
+		}
+		return nil
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		return fmt.Errorf("view op failed: %w", vErr)
+	}
+
+	fmt.Printf("terms scanned: %v\n", r.Terms)
+	fmt.Printf("duplicate entries: %v\n", r.Duplicates)
+	fmt.Printf("unsorted entries: %v\n", r.Unsorted)
+	fmt.Printf("zero-length lists: %v\n", r.Empty)
+	fmt.Printf("orphaned terms: %v\n", r.Orphaned)
+
+	if !*fix || len(repairs) == 0 {
+		return nil
+	}
+	t = xkcd.TraceTx("update", "main")
+	uErr := db.Update(func(tx *bolt.Tx) error {
+		if err := xkcd.InvalidateCache(tx); err != nil {
+			return err
+		}
+		b := tx.Bucket(xkcd.Bucket("main"))
+		for k, v := range repairs {
+			var err error
+			if v == nil {
+				err = b.Delete([]byte(k))
+				t.Delete()
+			} else {
+				err = b.Put([]byte(k), xkcd.Istobs(v))
+				t.Put([]byte(k), xkcd.Istobs(v))
+			}
+			if err != nil {
+				return fmt.Errorf("repair '%s' failed:\n%s", k, err)
+			}
+		}
+		return nil
+	})
+	t.Done(uErr)
+	if uErr != nil {
+		return fmt.Errorf("update transaction failed:\n%w", uErr)
+	}
+	fmt.Printf("terms repaired: %v\n", len(repairs))
+	return nil
+}
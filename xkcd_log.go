@@ -0,0 +1,346 @@
+package xkcd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// LegacyLog writes the append-only log in the original human-readable
+// format to 'comic_log.txt' instead of JSON Lines to 'comic_log.jsonl'.
+// The legacy log can't be read back by Rebuild.
+var LegacyLog bool
+
+// LogFile returns the path of the append-only log of downloaded comics in 'DataDir'
+func LogFile() string {
+	if LegacyLog {
+		return filepath.Join(DataDir, "comic_log.txt")
+	}
+	return filepath.Join(DataDir, "comic_log.jsonl")
+}
+
+// LogMaxSize is the size in bytes at which the log is rotated: it is
+// compressed to the next numbered segment (ex: 'comic_log.jsonl.3.gz')
+// and a new log is started. 0 disables rotation.
+var LogMaxSize int64 = 8 << 20
+
+// appendLog appends a comic's raw JSON info to the log, for comics stored
+// outside an update (refetches, retries and the proxy). The legacy log
+// only records updates.
+func appendLog(respInfo []byte) error {
+	if LegacyLog {
+		return nil
+	}
+	return writeOutput(respInfo)
+}
+
+// writeLog appends line to the log under its lock, so records of
+// concurrent processes never interleave or land in a segment being
+// rotated. The log is rotated first once it has reached 'LogMaxSize',
+// and synced to disk unless 'DBOptions.NoSync' is set.
+func writeLog(line []byte) (err error) {
+	unlock, err := Files.Lock(LogFile())
+	if err != nil {
+		return fmt.Errorf("lock %s failed: %v", LogFile(), err)
+	}
+	defer unlock()
+	if err := rotateLog(); err != nil {
+		return fmt.Errorf("rotate %s failed: %v", LogFile(), err)
+	}
+	f, err := Files.OpenFile(LogFile(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0766)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", LogFile(), err)
+	}
+	defer func() {
+		if cErr := f.Close(); err == nil {
+			err = cErr
+		}
+	}()
+	if _, err := f.Write(line); err != nil {
+		return err
+	}
+	if DBOptions.NoSync {
+		return nil
+	}
+	return f.Sync()
+}
+
+// writeRecord appends respInfo to the log as a single JSON line
+func writeRecord(respInfo []byte) error {
+	var line bytes.Buffer
+	if err := json.Compact(&line, respInfo); err != nil {
+		return fmt.Errorf("JSON compacting failed: %s", err)
+	}
+	line.WriteByte('\n')
+	return writeLog(line.Bytes())
+}
+
+// logSeq returns the sequence number of the log segment name, or 0 if
+// name isn't a segment of the log
+func logSeq(name string) int {
+	base := filepath.Base(LogFile()) + "."
+	if !strings.HasPrefix(name, base) || !strings.HasSuffix(name, ".gz") {
+		return 0
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, base), ".gz"))
+	if err != nil || n < 1 {
+		return 0
+	}
+	return n
+}
+
+// logSegments returns the paths of the compressed segments of the log,
+// oldest first. Directory entries are matched by name rather than with a
+// glob, so data directories with glob metacharacters work.
+func logSegments() ([]string, error) {
+	dir := filepath.Dir(LogFile())
+	files, err := Files.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, fi := range files {
+		if !fi.IsDir() && logSeq(fi.Name()) > 0 {
+			names = append(names, fi.Name())
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return logSeq(names[i]) < logSeq(names[j]) })
+	for i, name := range names {
+		names[i] = filepath.Join(dir, name)
+	}
+	return names, nil
+}
+
+// rotateLog compresses the log to the next numbered segment and removes
+// it once it has reached 'LogMaxSize'. The caller holds the log's lock.
+func rotateLog() error {
+	fi, err := Files.Stat(LogFile())
+	if os.IsNotExist(err) || LogMaxSize <= 0 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Size() < LogMaxSize {
+		return nil
+	}
+	segs, err := logSegments()
+	if err != nil {
+		return err
+	}
+	next := 1
+	if len(segs) > 0 {
+		next = logSeq(filepath.Base(segs[len(segs)-1])) + 1
+	}
+	name := fmt.Sprintf("%s.%d.gz", LogFile(), next)
+
+	in, err := Files.Open(LogFile())
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := Files.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	_, err = io.Copy(gz, in)
+	if cErr := gz.Close(); err == nil {
+		err = cErr
+	}
+	if sErr := out.Sync(); err == nil {
+		err = sErr
+	}
+	if cErr := out.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		Files.Remove(name)
+		return err
+	}
+	in.Close() // Windows can't remove open files
+	fmt.Printf("%s rotated to %s\n", LogFile(), name)
+	if err := Files.Remove(LogFile()); err != nil {
+		return err
+	}
+	return Files.SyncDir(filepath.Dir(LogFile()))
+}
+
+// readLog returns the last logged JSON info of each comic in the
+// compressed segments of 'comic_log.jsonl', oldest first, and the log
+func readLog() (map[int][]byte, error) {
+	unlock, err := Files.Lock(LogFile())
+	if err != nil {
+		return nil, fmt.Errorf("lock %s failed: %v", LogFile(), err)
+	}
+	defer unlock()
+	names, err := logSegments()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := Files.Stat(LogFile()); err == nil {
+		names = append(names, LogFile())
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%s not found", LogFile())
+	}
+	records := make(map[int][]byte)
+	for _, name := range names {
+		if err := readLogFile(name, records); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// LoggedInfo returns the latest raw JSON info of comic num recorded in
+// the log and its compressed segments, and false if none is retained
+func LoggedInfo(num int) ([]byte, bool, error) {
+	if LegacyLog {
+		return nil, false, nil
+	}
+	segs, err := logSegments()
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err := Files.Stat(LogFile()); os.IsNotExist(err) && len(segs) == 0 {
+		return nil, false, nil
+	}
+	records, err := readLog()
+	if err != nil {
+		return nil, false, err
+	}
+	info, ok := records[num]
+	return info, ok, nil
+}
+
+// readLogFile adds the records of the log file or gzipped segment name to records
+func readLogFile(name string, records map[int][]byte) error {
+	f, err := Files.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024) // transcripts can be long
+	for line := 1; s.Scan(); line++ {
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		}
+		var d LogData
+		if err := json.Unmarshal(s.Bytes(), &d); err != nil {
+			return fmt.Errorf("%s line %v: %v", name, line, err)
+		}
+		records[int(d.Num)] = append([]byte(nil), s.Bytes()...)
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
+
+// Rebuild restores the 'data' bucket from the records in
+// 'comic_log.jsonl' and its compressed segments, the latest record of
+// each comic winning, and then
+// rebuilds the inverted and title indexes from it with Reindex, without
+// downloading anything. Download times already stored are kept. It
+// returns the number of comics restored.
+func Rebuild() (int, error) {
+	if LegacyLog {
+		return 0, fmt.Errorf("the legacy log can't be rebuilt from")
+	}
+	records, err := readLog()
+	if err != nil {
+		return 0, fmt.Errorf("read log failed: %v", err)
+	}
+	if len(records) == 0 {
+		return 0, fmt.Errorf("%s has no records", LogFile())
+	}
+	var nums []int
+	for num := range records {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	db, err := OpenDB(IndexPath())
+	if err != nil {
+		return 0, fmt.Errorf("db failed to open:\n%s", err)
+	}
+	t := TraceTx("update", "data")
+	uErr := db.Update(func(tx *bolt.Tx) error {
+		if err := InvalidateCache(tx); err != nil {
+			return err
+		}
+		if tx.Bucket(Bucket("data")) != nil {
+			if err := tx.DeleteBucket(Bucket("data")); err != nil {
+				return fmt.Errorf("delete 'data' bucket failed:\n%s", err)
+			}
+		}
+		b, err := tx.CreateBucket(Bucket("data"))
+		if err != nil {
+			return fmt.Errorf("create 'data' bucket failed:\n%s", err)
+		}
+		total := 0
+		for _, num := range nums {
+			var d LogData
+			if err := json.Unmarshal(records[num], &d); err != nil {
+				return fmt.Errorf("JSON unmarshalling failed: %s", err)
+			}
+			if d.Link == "" { // 'Link' field is usually empty in json http response
+				d.Link = XKCDURL + strconv.Itoa(num)
+			}
+			pb := convToProto(d)
+			if err := b.Put(Itob(num), pb); err != nil {
+				return fmt.Errorf("put failed:\n%s", err)
+			}
+			t.Put(Itob(num), pb)
+			total += NewDoc(d).Len()
+			if _, ok := FetchedAt(tx, num); !ok {
+				if err := putFetched(tx, num, time.Now(), t); err != nil {
+					return err
+				}
+			}
+		}
+		return putTotalTerms(tx, total, t)
+	})
+	t.Done(uErr)
+	db.Close()
+	if uErr != nil {
+		return 0, fmt.Errorf("update transaction failed:\n%s", uErr)
+	}
+
+	if _, _, err := Reindex(); err != nil {
+		return len(nums), err
+	}
+	GetIndex()
+	if next := nums[len(nums)-1] + 1; next > Index {
+		if err := logIndexVar(next); err != nil {
+			return len(nums), fmt.Errorf("logIndexVar failed: %v", err)
+		}
+	}
+	return len(nums), nil
+}
@@ -0,0 +1,42 @@
+package xkcd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLogSegmentsOrder(t *testing.T) {
+	dataDir, legacy := DataDir, LegacyLog
+	defer func() { DataDir, LegacyLog = dataDir, legacy }()
+	DataDir, LegacyLog = filepath.Join(t.TempDir(), "data[1]"), false // glob metacharacters
+	if err := os.MkdirAll(filepath.Join(DataDir, "comic_log.jsonl.4.gz"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		"comic_log.jsonl.10.gz",
+		"comic_log.jsonl.2.gz",
+		"comic_log.jsonl.1.gz",
+		"comic_log.jsonl.x.gz",
+		"comic_log.jsonl.0.gz",
+		"comic_log.jsonl",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(DataDir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := logSegments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, name := range []string{"comic_log.jsonl.1.gz", "comic_log.jsonl.2.gz", "comic_log.jsonl.10.gz"} {
+		want = append(want, filepath.Join(DataDir, name))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("logSegments() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,118 @@
+package xkcd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+// Merge copies every comic in the database at path that isn't in
+// 'xkcd_index.db' into it, adding the comic's DocID to the posting lists
+// of its terms, and returns the number of comics merged. Comics stored in
+// both databases keep their current data. The postings are rebuilt from
+// the merged records with the current analyzer rather than copied, so a
+// DocID is never listed twice.
+func Merge(path string) (int, error) {
+	other, err := OpenDBReadOnly(path)
+	if err != nil {
+		return 0, fmt.Errorf("db failed to open:\n%s", err)
+	}
+	defer other.Close()
+	db, err := OpenDB(IndexPath())
+	if err != nil {
+		return 0, fmt.Errorf("db failed to open:\n%s", err)
+	}
+	defer db.Close()
+
+	// updates resume at the first comic missing after the merge, so the
+	// comics missing from both databases are still downloaded
+	if err := GetIndexContext(context.Background()); err != nil {
+		return 0, err
+	}
+	var merged int
+	next := Index
+	t := TraceTx("update", "main")
+	uErr := db.Update(func(tx *bolt.Tx) error {
+		return other.View(func(otx *bolt.Tx) error {
+			od := otx.Bucket(Bucket("data"))
+			if od == nil {
+				return fmt.Errorf("'data' bucket not found in %s", path)
+			}
+			if err := InvalidateCache(tx); err != nil {
+				return err
+			}
+			if err := recordTokenRules(tx, t); err != nil {
+				return err
+			}
+			data, err := tx.CreateBucketIfNotExists(Bucket("data"))
+			if err != nil {
+				return fmt.Errorf("create 'data' bucket failed:\n%s", err)
+			}
+			main, err := tx.CreateBucketIfNotExists(Bucket("main"))
+			if err != nil {
+				return fmt.Errorf("create 'main' bucket failed:\n%s", err)
+			}
+			tb, err := titleBucket(tx, t)
+			if err != nil {
+				return err
+			}
+
+			delta := 0
+			fErr := od.ForEach(func(k, v []byte) error {
+				i := Btoi(k)
+				t.Get()
+				if data.Get(k) != nil {
+					return nil
+				}
+				d, err := decodeLogData(v)
+				if err != nil {
+					return err
+				}
+				if err := data.Put(k, v); err != nil {
+					return fmt.Errorf("put failed:\n%s", err)
+				}
+				t.Put(k, v)
+				for term := range termSet(formatMapData(mapDataOf(d))) {
+					refs := insertRef(Bstois(main.Get([]byte(term))), i)
+					if err := main.Put([]byte(term), Istobs(refs)); err != nil {
+						return fmt.Errorf("put failed:\n%s", err)
+					}
+					t.Put([]byte(term), Istobs(refs))
+				}
+				if err := putTitle(tb, d.Title, i, t); err != nil {
+					return err
+				}
+				if at, ok := FetchedAt(otx, i); ok {
+					if err := putFetched(tx, i, at, t); err != nil {
+						return err
+					}
+				}
+				delta += NewDoc(d).Len()
+				merged++
+				return nil
+			})
+			if fErr != nil {
+				return fErr
+			}
+			if err := addTotalTerms(tx, delta, t); err != nil {
+				return err
+			}
+			for next == 404 || data.Get(Itob(next)) != nil {
+				next++
+			}
+			return nil
+		})
+	})
+	t.Done(uErr)
+	if uErr != nil {
+		return 0, fmt.Errorf("update transaction failed:\n%w", uErr)
+	}
+
+	if next > Index {
+		if err := logIndexVar(next); err != nil {
+			return merged, fmt.Errorf("logIndexVar failed: %v", err)
+		}
+	}
+	return merged, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// minShouldMatch is the minimum number of query terms a result must
+// match (ex: '2', '75%', '-1'); empty requires every term
+var minShouldMatch string
+
+// requiredMatches returns the number of the n unique query terms a result
+// must match under spec: a count ('2'), a percentage rounded down ('75%'),
+// or either subtracted from n ('-1' for all but one, '-25%'). The result
+// is at least 1 and at most n.
+func requiredMatches(spec string, n int) (int, error) {
+	s := strings.TrimSpace(spec)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	pct := strings.HasSuffix(s, "%")
+	s = strings.TrimSuffix(s, "%")
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 {
+		return 0, usageErrorf("invalid minimum should match %q", spec)
+	}
+	if pct {
+		v = n * v / 100
+	}
+	if neg {
+		v = n - v
+	}
+	if v < 1 {
+		v = 1
+	}
+	if v > n {
+		v = n
+	}
+	return v, nil
+}
+
+// minMatchRefs returns, in DocID order, the DocIDs found in at least
+// required of the lists in resultMap
+func minMatchRefs(resultMap map[string][]int, required int) []int {
+	counts := make(map[int]int)
+	for _, refs := range resultMap {
+		for _, v := range refs {
+			counts[v]++
+		}
+	}
+	var refs []int
+	for v, c := range counts {
+		if c >= required {
+			refs = append(refs, v)
+		}
+	}
+	sort.Ints(refs)
+	return refs
+}
+
+// matchedTerms returns the number of lists in resultMap containing DocID i
+func matchedTerms(resultMap map[string][]int, i int) int {
+	n := 0
+	for _, refs := range resultMap {
+		if j := sort.SearchInts(refs, i); j < len(refs) && refs[j] == i {
+			n++
+		}
+	}
+	return n
+}
+
+// sortByMatched orders results by number of query terms matched, then
+// by descending score, then by comic number
+func sortByMatched(results []Result) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Matched != results[j].Matched {
+			return results[i].Matched > results[j].Matched
+		}
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Data.Num < results[j].Data.Num
+	})
+}
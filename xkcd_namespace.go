@@ -0,0 +1,18 @@
+package xkcd
+
+// DefaultNamespace is the namespace of the original, unprefixed buckets
+const DefaultNamespace = "default"
+
+// Namespace selects one of several logical indexes kept side by side in
+// the same databases, each with its own buckets and 'Index' counter
+// (ex: to compare analyzers on the same corpus)
+var Namespace = DefaultNamespace
+
+// Bucket returns the name of bucket name in 'Namespace'. Buckets outside
+// the default namespace are prefixed with it (ex: 'experimental/main').
+func Bucket(name string) []byte {
+	if Namespace == DefaultNamespace || Namespace == "" {
+		return []byte(name)
+	}
+	return []byte(Namespace + "/" + name)
+}
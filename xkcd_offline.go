@@ -0,0 +1,26 @@
+package xkcd
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrOffline is returned by every request made while 'Offline' is set
+var ErrOffline = errors.New("offline mode: network access disabled")
+
+// Offline disables all network access. Requests made by the package, or
+// with the default 'Client', fail with 'ErrOffline' before any connection
+// is made.
+var Offline bool
+
+// offlineTransport refuses every request while 'Offline' is set
+type offlineTransport struct {
+	next http.RoundTripper
+}
+
+func (t offlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if Offline {
+		return nil, ErrOffline
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// onThisDay lists every comic published on today's calendar date in any
+// year ('xkcd onthisday', 'xkcd onthisday -date 04-01')
+func onThisDay(args []string) error {
+	fs := flag.NewFlagSet("onthisday", flag.ExitOnError)
+	date := fs.String("date", "", "calendar date as `MM-DD` instead of today")
+	fs.Parse(args)
+
+	day := time.Now()
+	if *date != "" {
+		d, err := time.Parse("01-02", *date)
+		if err != nil {
+			return usageErrorf("invalid date %q: expected MM-DD", *date)
+		}
+		day = d
+	}
+	month, dom := strconv.Itoa(int(day.Month())), strconv.Itoa(day.Day())
+
+	if err := checkIndex(); err != nil {
+		return err
+	}
+	db, err := openIndex(false)
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+	var comics []xkcd.LogData
+	err = eachComic(db, func(d xkcd.LogData) {
+		if d.Month == month && d.Day == dom {
+			comics = append(comics, d)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(comics, func(i, j int) bool { return comics[i].Num < comics[j].Num })
+
+	fmt.Printf("comics published on %s:\n\n", day.Format("January 2"))
+	for _, d := range comics {
+		fmt.Printf("%s\t%5d\t%s\t%s\n", comicDate(d), d.Num, d.Title, d.Link)
+	}
+	if len(comics) == 0 {
+		return errNoResults
+	}
+	return nil
+}
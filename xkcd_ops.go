@@ -4,12 +4,17 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"os/signal"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/golang/protobuf/proto"
@@ -29,10 +34,221 @@ func main() {
 	viewIndex := flag.Bool("vi", false, "view inverted index")
 	viewData := flag.Bool("vd", false, "view data index")
 	search := flag.Bool("s", false, "search index")
+	replay := flag.String("replay", "", "update from JSON files captured in `dir` instead of xkcd.com")
+	record := flag.String("record", "", "capture JSON responses to `dir` during update")
+	cpuprofile := flag.String("cpuprofile", "", "write cpu profile to `file`")
+	memprofile := flag.String("memprofile", "", "write memory profile to `file` on exit")
+	pprofAddr := flag.String("pprof", "", "serve pprof HTTP endpoint on `addr` (ex: localhost:6060)")
+	debug := flag.Bool("debug", false, "log each bolt transaction")
+	attempts := flag.Int("attempts", xkcd.Retry.Attempts, "make up to `n` attempts per request, retrying network errors and 5xx responses with exponential backoff")
+	connectTimeout := flag.Duration("connecttimeout", xkcd.RequestTimeouts.Connect, "how long to wait for each connection to a server (0 waits indefinitely)")
+	readTimeout := flag.Duration("readtimeout", xkcd.RequestTimeouts.Read, "how long to wait for each response to be received (0 waits indefinitely)")
+	userAgent := flag.String("useragent", xkcd.UserAgent, "identify requests with the User-Agent `string`")
+	flag.Func("header", "send the `header` (ex: 'From: me@example.com') with every request; may be repeated", func(h string) error {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("expected 'Name: value'")
+		}
+		xkcd.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		return nil
+	})
+	proxyFlag := flag.String("proxy", "", "send requests through the proxy at `url` instead of the one set by $HTTP_PROXY and $HTTPS_PROXY")
+	rate := flag.Float64("rate", xkcd.RateLimit, "send at most `n` requests per second to xkcd.com (0 for no limit)")
+	rangeFlag := flag.String("range", "", "with -u, download and index only the comics in the inclusive `range` (ex: 1000-1100)")
+	checkpointFlag := flag.Int("checkpoint", xkcd.Checkpoint, "store the comics downloaded by an update every `n` comics (0 stores them once the update finishes)")
+	workers := flag.Int("workers", 1, "download up to `n` comics concurrently when updating")
+	scrape := flag.Bool("scrape", false, "fill in empty transcripts from each comic's page HTML when updating")
+	translate := flag.String("translate", "", "shell `command` translating stdin into $XKCD_LANG; translates new comics on update")
+	langs := flag.String("langs", "", "comma-separated `languages` to translate titles and alt text into (ex: es,de)")
+	offline := flag.Bool("offline", false, "never access the network: update and fetch commands refuse to run")
+	namespace := flag.String("index", xkcd.DefaultNamespace, "`name` of the index namespace to use (ex: experimental)")
+	dbTimeout := flag.Duration("dbtimeout", 0, "how long to wait for the database lock (0 waits indefinitely)")
+	noSync := flag.Bool("nosync", false, "skip fsync after each database commit (faster bulk loads, less durable)")
+	readOnly := flag.Bool("readonly", false, "open the database read-only")
+	mmapSize := flag.Int("mmapsize", 0, "initial database memory map size in `bytes`")
+	noHistory := flag.Bool("nohistory", false, "don't record searches in the search history")
+	rank := flag.Bool("rank", false, "order search results by score")
+	explainFlag := flag.Bool("explain", false, "show matched terms, fields, frequencies and score per search result")
+	weights := flag.String("weights", "", "field weights for ranking as field=weight pairs (ex: title=3,alt=2,transcript=1)")
+	msm := flag.String("msm", "", "minimum number of query terms a result must match: count, percentage or all but N (ex: 2, 75%, -1)")
+	proximityFlag := flag.Float64("proximity", 1, "weight of the boost for query terms close together in the transcript (0 disables)")
+	scorerFlag := flag.String("scorer", "", "rank results with the registered scorer `name` (bm25, count, or one registered by the embedding application) instead of weighted tf-idf")
+	recent := flag.Float64("recent", 0, "rank results with a boost of `weight` for newer comics (ex: 0.5)")
+	source := flag.String("source", "", "search the comma-separated `sources` (index namespaces) instead of -index (ex: default,whatif)")
+	title := flag.Bool("title", false, "match search query against comic titles only (exact, then prefix)")
+	snippetFlag := flag.Int("snippet", 200, "print at most `n` characters of each result's transcript (0 prints all of it)")
+	contextFlag := flag.Int("context", 0, "print `n` words either side of each query term in the transcript snippet")
+	links := flag.Bool("links", false, "show permalink, mobile and explainxkcd links with each search result")
+	format := flag.String("format", "text", "search result `format`: text, table, ndjson or rss")
+	tmpl := flag.String("template", "", "format each search result with a text/template `string` (ex: '{{.Num}}: {{.Title}} - {{.Link}}')")
+	legacy := flag.Bool("legacy", false, "write the log of downloaded comics in the old human-readable format to comic_log.txt instead of JSON Lines")
+	logSize := flag.Int64("logsize", xkcd.LogMaxSize, "rotate and gzip the comic log once it reaches this many bytes; 0 disables rotation")
+	dataDir := flag.String("datadir", xkcd.DataDir, "keep the databases and the comic log in `dir` (ex: . for the working directory)")
+	cacheDir := flag.String("cachedir", xkcd.CacheDir, "cache downloaded images and thumbnails in `dir`")
+	configFile := flag.String("config", defaultConfig, "read settings such as tokenization rules from JSON config `file`")
+	periodFlag := flag.String("period", "", "restrict commands to comics published in `period` (ex: 2015, 2015-03, 2014:2016)")
 
 	flag.Parse()
+	explicitConfig := false
+	flag.Visit(func(f *flag.Flag) { explicitConfig = explicitConfig || f.Name == "config" })
+	if err := loadConfig(*configFile, explicitConfig); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	xkcd.Debug = *debug
+	xkcd.LegacyLog = *legacy
+	xkcd.LogMaxSize = *logSize
+	if err := preparePaths(*dataDir, *cacheDir); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitIndex)
+	}
+	xkcd.Offline = *offline
+	xkcd.ScrapeTranscripts = *scrape
+	if *workers < 1 {
+		fmt.Fprintln(os.Stderr, "-workers must be at least 1")
+		os.Exit(exitUsage)
+	}
+	xkcd.FetchWorkers = *workers
+	if *checkpointFlag < 0 {
+		fmt.Fprintln(os.Stderr, "-checkpoint must not be negative")
+		os.Exit(exitUsage)
+	}
+	xkcd.Checkpoint = *checkpointFlag
+	if *attempts < 1 {
+		fmt.Fprintln(os.Stderr, "-attempts must be at least 1")
+		os.Exit(exitUsage)
+	}
+	xkcd.Retry.Attempts = *attempts
+	if *rate < 0 {
+		fmt.Fprintln(os.Stderr, "-rate must not be negative")
+		os.Exit(exitUsage)
+	}
+	xkcd.RateLimit = *rate
+	xkcd.UserAgent = *userAgent
+	xkcd.RequestTimeouts = xkcd.Timeouts{Connect: *connectTimeout, Read: *readTimeout}
+	if *proxyFlag != "" {
+		u, err := url.Parse(*proxyFlag)
+		if err != nil || u.Host == "" {
+			fmt.Fprintf(os.Stderr, "invalid proxy: %q\n", *proxyFlag)
+			os.Exit(exitUsage)
+		}
+		xkcd.Proxy = u
+	}
+	if *translate != "" {
+		translator = xkcd.CommandTranslator{Command: *translate}
+	}
+	translateLangs = parseLangs(*langs)
+	if *namespace == "" || strings.Contains(*namespace, "/") {
+		fmt.Fprintf(os.Stderr, "invalid index name: %q\n", *namespace)
+		os.Exit(exitUsage)
+	}
+	xkcd.Namespace = *namespace
+	if *source != "" {
+		searchSources = strings.Split(*source, ",")
+	}
+	xkcd.DBOptions = xkcd.Options{
+		Timeout:         *dbTimeout,
+		NoSync:          *noSync,
+		ReadOnly:        *readOnly,
+		InitialMmapSize: *mmapSize,
+	}
+	logHistory = !*noHistory
+	rankResults = *rank || *recent > 0 || *scorerFlag != ""
+	if *scorerFlag != "" {
+		s, ok := xkcd.LookupScorer(*scorerFlag)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown scorer %q: expected one of %s\n", *scorerFlag, strings.Join(xkcd.ScorerNames(), ", "))
+			os.Exit(exitUsage)
+		}
+		scorer, scorerName = s, *scorerFlag
+	}
+	recentWeight = *recent
+	explainResults = *explainFlag
+	titleSearch = *title
+	minShouldMatch = *msm
+	outputFormat = *format
+	showLinks = *links
+	snippetLength = *snippetFlag
+	snippetContext = *contextFlag
+	switch outputFormat {
+	case "text", "table", "ndjson", "rss":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown output format: %q\n", outputFormat)
+		os.Exit(exitUsage)
+	}
+	if *tmpl != "" {
+		t, err := parseResultTemplate(*tmpl)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitUsage)
+		}
+		resultTemplate = t
+	}
+	proximityWeight = *proximityFlag
+	if *weights != "" {
+		if err := parseWeights(*weights); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitUsage)
+		}
+	}
+	if *periodFlag != "" {
+		p, err := parsePeriod(*periodFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitUsage)
+		}
+		activePeriod = p
+	}
+	if *rangeFlag != "" {
+		nums, err := parseNums([]string{*rangeFlag})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitUsage)
+		}
+		updateRange = [2]int{nums[0], nums[len(nums)-1]}
+	}
+	xkcd.ReplayDir = *replay
+	xkcd.RecordDir = *record
+
+	stopProfile, err := startProfile(*cpuprofile, *memprofile, *pprofAddr)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer stopProfile()
+	defer closeIndex()
+
+	// subcommands (ex: 'xkcd lint --fix') follow any global flags
+	if flag.NArg() > 0 {
+		err := runCommand(flag.Arg(0), flag.Args()[1:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			closeIndex()
+			stopProfile()
+			os.Exit(exitCode(err))
+		}
+		return
+	}
 	if *update != false {
-		updateIndex()
+		if err := requireNetwork("-u"); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			stopProfile()
+			os.Exit(exitCode(err))
+		}
+		if err := updateIndex(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			closeIndex()
+			stopProfile()
+			os.Exit(exitCode(err))
+		}
+	}
+	if *viewIndex || *viewData {
+		if err := checkIndex(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			closeIndex()
+			stopProfile()
+			os.Exit(exitCode(err))
+		}
 	}
 	if *viewIndex != false {
 		viewInvertedIndex()
@@ -41,101 +257,534 @@ func main() {
 		viewDataIndex()
 	}
 	if *search != false {
-		err := searchIndex()
-		if err != nil {
-			fmt.Println(err)
+		if err := searchIndex(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			closeIndex()
+			stopProfile()
+			os.Exit(exitCode(err))
+		}
+	}
+}
+
+// runCommand runs the named subcommand with its remaining arguments
+func runCommand(name string, args []string) error {
+	switch name {
+	case "refetch", "backfill", "watch", "reconcile":
+		if err := requireNetwork(name); err != nil {
+			return err
+		}
+	}
+	switch name {
+	case "lint":
+		return lintIndex(args)
+	case "selftest":
+		return selfTest()
+	case "sample":
+		return sampleData(args)
+	case "refetch":
+		if err := checkIndex(); err != nil {
+			return err
+		}
+		closeIndex() // xkcd.Refetch opens the database itself
+		return refetchComics(args)
+	case "merge":
+		closeIndex() // xkcd.Merge opens the database itself
+		return mergeIndex(args)
+	case "shards":
+		if err := checkIndex(); err != nil {
+			return err
+		}
+		closeIndex() // xkcd.BuildShards opens the database itself
+		return shardIndex(args)
+	case "proxy":
+		if err := checkIndex(); err != nil {
+			return err
+		}
+		closeIndex() // the proxy opens the database itself
+		return proxyComics(args)
+	case "reconcile":
+		return reconcileIndex(args)
+	case "rebuild":
+		closeIndex() // xkcd.Rebuild opens the database itself
+		return rebuildIndex()
+	case "reindex":
+		closeIndex() // xkcd.Reindex opens the database itself
+		return reindexIndex()
+	case "job":
+		closeIndex() // jobs open the database themselves
+		return jobCommand(args)
+	case "runs":
+		return listRuns(args)
+	case "failures":
+		return failureCommand(args)
+	case "terms":
+		return topTerms(args)
+	case "report":
+		return corpusReport(args)
+	case "history":
+		return searchHistory(args)
+	case "trend":
+		return termTrend(args)
+	case "similar":
+		return similarComics(args)
+	case "cluster":
+		return clusterComics(args)
+	case "cooccur":
+		return cooccurringTerms(args)
+	case "periods":
+		return periodCounts(args)
+	case "get":
+		return getComic(args)
+	case "title":
+		return titleLookup(args)
+	case "inspect":
+		return inspectComic(args)
+	case "backfill":
+		return backfillIndex(args)
+	case "watch":
+		return watchComics(args)
+	case "import":
+		return importDocuments(args)
+	case "onthisday":
+		return onThisDay(args)
+	case "translate":
+		return translateComics(args)
+	case "alerts":
+		return alertCommand(args)
+	case "images":
+		return imageCommand(args)
+	case "alttext":
+		return altTextReport(args)
+	case "du":
+		return diskUsage(args)
+	default:
+		return usageErrorf("unknown command: %q", name)
+	}
+}
+
+// parseArgs parses the flags of a subcommand, which may come before or
+// after its positional arguments (ex: 'xkcd get 927 --json'), and
+// returns the positional arguments
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var pos []string
+	for {
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			return pos
 		}
+		pos = append(pos, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// refetchComics re-downloads and reindexes the comics given as
+// numbers or ranges ('xkcd refetch 1234 1000-1100')
+func refetchComics(args []string) error {
+	nums, err := parseNums(args)
+	if err != nil {
+		return err
+	}
+	if len(nums) == 0 {
+		return usageErrorf("usage: xkcd refetch <num|from-to>...")
+	}
+	return xkcd.Refetch(nums)
+}
+
+// mergeIndex merges the comics of another database into the index
+func mergeIndex(args []string) error {
+	if len(args) != 1 {
+		return usageErrorf("usage: xkcd merge <other.db>")
+	}
+	if _, err := os.Stat(args[0]); err != nil {
+		return usageErrorf("merge: %v", err)
+	}
+	n, err := xkcd.Merge(args[0])
+	if err != nil {
+		return indexErrorf("merge failed: %v", err)
 	}
+	fmt.Printf("comics merged: %v\n", n)
+	return nil
 }
 
-// updateIndex updates the index since the most recent file stored
-func updateIndex() {
-	xkcd.GetIndex() // first run - log.db does not exist
-	err := xkcd.GetInfo()
+// rebuildIndex restores the index from the log of downloaded comics
+func rebuildIndex() error {
+	start := time.Now()
+	n, err := xkcd.Rebuild()
 	if err != nil {
-		fmt.Printf("failed: %v", err)
+		return indexErrorf("rebuild failed: %v", err)
+	}
+	fmt.Printf("comics restored from %s: %v\n", xkcd.LogFile(), n)
+	fmt.Printf("rebuild finished in %v\n", time.Since(start))
+	return nil
+}
+
+// reindexIndex rebuilds the inverted and title indexes from the stored
+// comics with the tokenization rules in use, without downloading anything
+func reindexIndex() error {
+	start := time.Now()
+	comics, terms, err := xkcd.Reindex()
+	if err != nil {
+		return indexErrorf("reindex failed: %v", err)
+	}
+	fmt.Printf("comics reindexed: %v, terms: %v\n", comics, terms)
+	fmt.Printf("reindex finished in %v\n", time.Since(start))
+	return nil
+}
+
+// shardIndex enables the year-sharded layout and rebuilds its shards, or
+// disables it ('xkcd shards -off')
+func shardIndex(args []string) error {
+	fs := flag.NewFlagSet("shards", flag.ExitOnError)
+	off := fs.Bool("off", false, "disable the year-sharded layout and delete its shards")
+	fs.Parse(args)
+
+	if *off {
+		if err := xkcd.DropShards(); err != nil {
+			return indexErrorf("shards: %v", err)
+		}
+		fmt.Println("year shards deleted")
+		return nil
+	}
+	n, err := xkcd.BuildShards()
+	if err != nil {
+		return indexErrorf("shards: %v", err)
+	}
+	fmt.Printf("year shards built: %v\n", n)
+	return nil
+}
+
+// parseNums parses comic numbers and inclusive ranges (ex: '1000-1100')
+func parseNums(args []string) ([]int, error) {
+	var nums []int
+	for _, a := range args {
+		from, to := a, a
+		if i := strings.Index(a, "-"); i > 0 {
+			from, to = a[:i], a[i+1:]
+		}
+		f, fErr := strconv.Atoi(from)
+		t, tErr := strconv.Atoi(to)
+		if fErr != nil || tErr != nil || f < 1 || t < f {
+			return nil, usageErrorf("invalid comic number or range: %q", a)
+		}
+		for n := f; n <= t; n++ {
+			nums = append(nums, n)
+		}
+	}
+	return nums, nil
+}
+
+// updateRange is the first and last comic updates download with the
+// 'range' flag, and zero to download every new comic
+var updateRange [2]int
+
+// updateIndex updates the index since the most recent file stored, or
+// indexes only the comics in 'updateRange' when set
+func updateIndex() error {
+	start := time.Now()
+	if updateRange[0] > 0 {
+		n, err := xkcd.FetchRange(updateRange[0], updateRange[1])
+		if err != nil {
+			return fmt.Errorf("failed: %w", err)
+		}
+		fmt.Printf("comics indexed: %v\n", n)
+		return finishUpdate(start)
+	}
+	xkcd.RegisterHooks(xkcd.Hooks{OnProgress: printProgress})
+	// an interrupt stops the downloads and stores the comics mapped so far
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := xkcd.GetIndexContext(ctx); err != nil { // first run - log.db does not exist
+		return fmt.Errorf("failed: %w", err)
+	}
+	err := xkcd.GetInfoContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed: %w", err)
+	}
+	return finishUpdate(start)
+}
+
+// finishUpdate translates the new comics and rebuilds the shards after
+// an update started at start
+func finishUpdate(start time.Time) error {
+	if translator != nil && len(translateLangs) > 0 {
+		n, err := xkcd.Translate(translator, translateLangs, nil)
+		if err != nil {
+			return fmt.Errorf("translation failed: %w", err)
+		}
+		fmt.Printf("translations added: %v\n", n)
+	}
+	if err := xkcd.RefreshShards(); err != nil {
+		return fmt.Errorf("shard rebuild failed: %w", err)
+	}
+	fmt.Printf("update finished in %v\n", time.Since(start))
+	return nil
+}
+
+// backfillIndex downloads every comic not yet indexed concurrently
+// ('xkcd backfill -workers 16 -batch 500')
+func backfillIndex(args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	workers := fs.Int("workers", 16, "maximum concurrent requests")
+	batch := fs.Int("batch", 500, "comics committed per transaction")
+	retries := fs.Int("retries", 3, "attempts to re-request a failed comic")
+	fs.Parse(args)
+	if *workers < 1 || *batch < 1 || *retries < 1 {
+		return usageErrorf("-workers, -batch and -retries must be at least 1")
 	}
+
+	start := time.Now()
+	xkcd.BackfillRetries = *retries
+	if err := xkcd.Backfill(*workers, *batch); err != nil {
+		return fmt.Errorf("backfill failed: %w", err)
+	}
+	if err := xkcd.RefreshShards(); err != nil {
+		return fmt.Errorf("shard rebuild failed: %w", err)
+	}
+	fmt.Printf("backfill finished in %v\n", time.Since(start))
+	return nil
 }
 
 // viewInvertedIndex displays the inverted index
 func viewInvertedIndex() {
 	ct := 0
-	db, oErr := bolt.Open("xkcd_index.db", 0766, nil)
+	db, oErr := openIndex(false)
 	if oErr != nil {
 		fmt.Printf("db failed to open:\n%s", oErr)
 	}
-	defer db.Close()
 
+	t := xkcd.TraceTx("view", "main")
 	vErr := db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("main"))
+		b := tx.Bucket(xkcd.Bucket("main"))
 		c := b.Cursor()
 		for k, v := c.First(); k != nil; k, v = c.Next() {
 			fmt.Printf("key = '%s'\tvalue = %v\n", k, xkcd.Bstois(v))
+			t.Get()
 			ct++
 		}
 		return nil
 	})
+	t.Done(vErr)
 
 	if vErr != nil {
 		fmt.Printf("view op failed: %s\n", vErr)
 	}
 
-	fmt.Println("\nTotal entries: %v", ct)
+	fmt.Printf("\nTotal entries: %v\n", ct)
 }
 
 // viewDataIndex displays the index of json data stored as protocol buffers
 func viewDataIndex() {
 	ct := 0
-	db, oErr := bolt.Open("xkcd_index.db", 0766, nil)
+	db, oErr := openIndex(false)
 	if oErr != nil {
 		fmt.Printf("db failed to open:\n%s", oErr)
 	}
-	defer db.Close()
 
+	t := xkcd.TraceTx("view", "data")
 	vErr := db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("data"))
+		b := tx.Bucket(xkcd.Bucket("data"))
 		c := b.Cursor()
 		for k, v := c.First(); k != nil; k, v = c.Next() {
 			fmt.Printf("key = '%v'\tvalue = %+v\n\n", xkcd.Btoi(k), decodeProto(v))
+			t.Get()
 			ct++
 		}
 		return nil
 	})
+	t.Done(vErr)
 
 	if vErr != nil {
 		fmt.Printf("view op failed: %s\n", vErr)
 	}
 
-	fmt.Println("\nTotal entries: %v", ct)
+	fmt.Printf("\nTotal entries: %v\n", ct)
 }
 
 // searchIndex returns data for all files containing every word in query
 func searchIndex() error {
 	reader := bufio.NewReader(os.Stdin)
-	fmt.Print("Enter search query: ")
+	fmt.Fprint(os.Stderr, "Enter search query: ") // keep stdout to results
 
 	// Get references for each term in query as user input
 	text, _ := reader.ReadString('\n')
-	query := strings.Split(text, " ")
+	return runSearch(text)
+}
+
+// runSearch prints data for all files containing every word in query
+// text and records the query in the search history. It returns
+// 'errNoResults' when no comics match.
+func runSearch(text string) error {
+	query, filters, err := parseQuery(text)
+	if err != nil {
+		return err
+	}
+	if len(query) == 0 && (len(filters) == 0 || titleSearch) {
+		return usageErrorf("empty query")
+	}
+	queryFilters = filters
+	terms := strings.Join(query, " ")
+	sources := searchSources
+	if len(sources) == 0 {
+		sources = []string{xkcd.Namespace}
+	}
+	ns := xkcd.Namespace
+	defer func() { xkcd.Namespace = ns }()
+
+	var results []Result
+	skipped := 0
+	for _, src := range sources {
+		xkcd.Namespace = src
+		rs, streamed, err := searchSource(query, terms, len(sources) == 1)
+		if err != nil && len(sources) > 1 && exitCode(err) == exitIndex {
+			// a source that hasn't been indexed doesn't fail the others
+			fmt.Fprintf(os.Stderr, "warning: skipping source '%s': %v\n", src, err)
+			if skipped++; skipped == len(sources) {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if streamed != nil {
+			xkcd.Namespace = ns
+			xkcd.Searched(text, streamed)
+			if err := logQuery(text, len(streamed)); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to log query: %v\n", err)
+			}
+			if len(streamed) == 0 {
+				return errNoResults
+			}
+			return nil
+		}
+		for i := range rs {
+			rs[i].Source = src
+		}
+		results = append(results, rs...)
+	}
+	xkcd.Namespace = ns
+
+	// results are always ordered by score, then by comic number. Unranked
+	// results all score the same; title matches keep exact matches first.
+	switch {
+	case minShouldMatch != "" && !titleSearch:
+		sortByMatched(results)
+	case rankResults:
+		sortByScore(results)
+	case !titleSearch:
+		sortByNum(results)
+	}
+	if err := printResults(text, results); err != nil {
+		return err
+	}
+	refs := make([]int, len(results))
+	for i, r := range results {
+		refs[i] = int(r.Data.Num)
+	}
+	xkcd.Searched(text, refs)
+
+	if err := logQuery(text, len(results)); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to log query: %v\n", err)
+	}
+	if len(results) == 0 {
+		return errNoResults
+	}
+	return nil
+}
+
+// searchSource returns the scored results of query in the current
+// namespace. When stream is set and the results don't need ordering,
+// they are written as NDJSON instead and their DocIDs are returned as
+// streamed, which is nil otherwise.
+func searchSource(query []string, text string, stream bool) (results []Result, streamed []int, err error) {
+	if err := checkIndex(); err != nil {
+		return nil, nil, err
+	}
+	refs, resultMap, err := queryRefs(query, text)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// stream unordered results without buffering them
+	ordered := (minShouldMatch != "" && !titleSearch) || rankResults
+	if stream && outputFormat == "ndjson" && resultTemplate == nil && !ordered {
+		if !titleSearch {
+			sort.Ints(refs)
+		}
+		written, err := streamResults(refs)
+		return nil, written, err
+	}
+
+	// Get data for the common values
+	return scoreResults(query, filterComparisons(filterPeriod(returnData(refs))), resultMap), nil, nil
+}
+
+// queryRefs returns the DocIDs matching query and, unless they were
+// served from the result cache, the posting list of each term. Cached
+// results are only used when ranking, explaining and minimum should match
+// are off, as they need the posting lists.
+func queryRefs(query []string, text string) ([]int, map[string][]int, error) {
+	if len(query) == 0 { // comparisons only - filter every comic
+		refs, err := allRefs()
+		return refs, map[string][]int{}, err
+	}
+	key := cacheKey(query, text)
+	needLists := !titleSearch && (rankResults || explainResults || minShouldMatch != "")
+	if !needLists {
+		if refs, ok := cachedRefs(key); ok {
+			return refs, nil, nil
+		}
+	}
+
+	var refs []int
+	var resultMap map[string][]int
+	var err error
+	if titleSearch {
+		refs, err = titleRefs(text)
+	} else {
+		resultMap, err = periodRefs(query)
+		refs = commonRefs(resultMap)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get results: %w", err)
+	}
+	if minShouldMatch != "" && !titleSearch {
+		required, err := requiredMatches(minShouldMatch, len(resultMap))
+		if err != nil {
+			return nil, nil, err
+		}
+		refs = minMatchRefs(resultMap, required)
+	}
+
+	if err := cacheRefs(key, refs); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to cache results: %v\n", err)
+	}
+	return refs, resultMap, nil
+}
+
+// findCommon returns the DocIDs common to every term in query
+func findCommon(query []string) ([]int, error) {
 	resultMap, err := getRefs(query)
 	if err != nil {
-		return fmt.Errorf("failed to get results: %v", err)
+		return nil, err
 	}
+	return commonRefs(resultMap), nil
+}
 
+// commonRefs returns the DocIDs common to every list in resultMap
+func commonRefs(resultMap map[string][]int) []int {
 	// Skip sorting and intersection if only one word in query
 	if len(resultMap) == 1 {
 		for _, v := range resultMap {
-			r := returnData(v)
-			for _, s := range r {
-				fmt.Printf("Num: %d\nLink: %s\nTitle: %s\nTranscript: %s\n\n",
-					s.Num, s.Link, s.Title, s.Transcript)
-			}
+			return v
 		}
-		return nil
 	}
 
 	// Sort lists by smallest to largest
 	sorted := sortMap(resultMap)
+	if sorted[0].Len == 0 {
+		return nil // no intersection if any term is missing
+	}
 
 	// Compare values in each list and find all common values
 	// Start by finding the common values in the 2 smallest lists
@@ -143,42 +792,126 @@ func searchIndex() error {
 	s1, s2 := sorted[0].Value, sorted[1].Value
 	common := intersection(s1, s2)
 	for _, v := range sorted[2:] {
+		if len(common) == 0 {
+			break
+		}
 		common = intersection(common, v.Value)
 	}
-
-	// Get data for the common values
-	results := returnData(common)
-	fmt.Println("results returned")
-	for _, v := range results {
-		fmt.Printf("Num: %d\nTitle: %s\nTranscript: %s\nLink: %s\n\n",
-			v.Num, v.Title, v.Transcript, v.Link)
-	}
-	return nil
+	return common
 }
 
-// getRefs finds the references for each term in query
+// getRefs finds the references for each term in query. Terms recorded
+// as absent from the index aren't read, and newly found absent terms are
+// recorded.
 func getRefs(q []string) (map[string][]int, error) {
 	var resultMap = make(map[string][]int)
 	var result []int
-	db, oErr := bolt.Open("xkcd_index.db", 0766, nil)
-	if oErr != nil {
-		fmt.Printf("db failed to open:\n%s", oErr)
+	db, err := openIndex(false)
+	if err != nil {
+		return nil, fmt.Errorf("db failed to open:\n%s", err)
 	}
-	defer db.Close()
+
+	absent := make(map[string]bool)
+	t := xkcd.TraceTx("view", "absent")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		absent = xkcd.AbsentTerms(tx, q)
+		t.Get()
+		return nil
+	})
+	t.Done(vErr)
 
 	// Get index list for each term in query - use map
+	var missing []string
 	for _, v := range q {
+		v = strings.TrimSpace(v)
+		if absent[v] {
+			resultMap[v] = nil
+			continue
+		}
+		t := xkcd.TraceTx("view", "main")
 		vErr := db.View(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte("main"))
-			v = strings.TrimSpace(v)
+			b := tx.Bucket(xkcd.Bucket("main"))
 			result = xkcd.Bstois(b.Get([]byte(v)))
+			t.Get()
 			return nil
 		})
+		t.Done(vErr)
 
 		if vErr != nil {
-			return nil, fmt.Errorf("view op failed: %s", vErr)
+			return nil, fmt.Errorf("view op failed: %w", vErr)
 		}
 		resultMap[v] = result
+		if len(result) == 0 {
+			absent[v] = true
+			missing = append(missing, v)
+		}
+	}
+	if err := recordAbsent(missing); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to cache absent terms: %v\n", err)
+	}
+	return resultMap, nil
+}
+
+// recordAbsent records terms as absent from the index. Nothing is
+// recorded when the database is opened with -readonly.
+func recordAbsent(terms []string) error {
+	if len(terms) == 0 || xkcd.DBOptions.ReadOnly {
+		return nil
+	}
+	db, err := openIndex(true)
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+	defer releaseWrite()
+	t := xkcd.TraceTx("update", "absent")
+	uErr := db.Update(func(tx *bolt.Tx) error {
+		for _, term := range terms {
+			t.Put([]byte(term), nil)
+		}
+		return xkcd.RecordAbsent(tx, terms)
+	})
+	t.Done(uErr)
+	if uErr != nil {
+		return fmt.Errorf("update transaction failed:\n%w", uErr)
+	}
+	return nil
+}
+
+// periodRefs finds the references for each term in query, reading only
+// the year shards covering 'activePeriod' when the index has them.
+// Ranked and explained searches use the complete posting lists, as the
+// scores depend on their lengths.
+func periodRefs(q []string) (map[string][]int, error) {
+	if activePeriod == nil || rankResults || explainResults {
+		return getRefs(q)
+	}
+	db, oErr := openIndex(false)
+	if oErr != nil {
+		fmt.Printf("db failed to open:\n%s", oErr)
+	}
+	years := activePeriod.years()
+	resultMap := make(map[string][]int)
+	sharded := true
+	t := xkcd.TraceTx("view", "shards")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		for _, v := range q {
+			v = strings.TrimSpace(v)
+			refs, ok := xkcd.ShardRefs(tx, years, v)
+			if !ok {
+				sharded = false
+				return nil
+			}
+			t.Get()
+			resultMap[v] = refs
+		}
+		return nil
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		return nil, fmt.Errorf("view op failed: %w", vErr)
+	}
+	if !sharded {
+		return getRefs(q)
 	}
 	return resultMap, nil
 }
@@ -218,19 +951,21 @@ func intersection(s1, s2 []int) (c []int) {
 // returnData retreives the data for each DocID common to all slices in query
 func returnData(c []int) []xkcd.LogData {
 	var results []xkcd.LogData
-	db, oErr := bolt.Open("xkcd_index.db", 0766, nil)
+	db, oErr := openIndex(false)
 	if oErr != nil {
 		fmt.Printf("db failed to open:\n%s", oErr)
 	}
-	defer db.Close()
 
 	for _, v := range c {
+		t := xkcd.TraceTx("view", "data")
 		vErr := db.View(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte("data"))
+			b := tx.Bucket(xkcd.Bucket("data"))
 			data := decodeProto(b.Get([]byte(xkcd.Itob(v))))
+			t.Get()
 			results = append(results, data)
 			return nil
 		})
+		t.Done(vErr)
 
 		if vErr != nil {
 			fmt.Printf("view op failed: %s\n", vErr)
@@ -247,9 +982,9 @@ func decodeProto(pb []byte) xkcd.LogData {
 		log.Fatalf("unmarshal failed: %v\n", err)
 	}
 
-	entry := xkcd.LogData{o.GetMonth(), o.GetNum(), o.GetLink(), o.GetYear(),
-		o.GetNews(), o.GetSafeTitle(), o.GetTranscript(), o.GetAlt(), o.GetImg(),
-		o.GetTitle(), o.GetDay()}
+	entry := xkcd.LogData{Month: o.GetMonth(), Num: o.GetNum(), Link: o.GetLink(), Year: o.GetYear(),
+		News: o.GetNews(), SafeTitle: o.GetSafeTitle(), Transcript: o.GetTranscript(), Alt: o.GetAlt(), Img: o.GetImg(),
+		Title: o.GetTitle(), Day: o.GetDay()}
 
 	return entry
 }
@@ -0,0 +1,91 @@
+package xkcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Options tunes how the BoltDB databases are opened, trading durability
+// for speed on slow disks or during bulk loads
+type Options struct {
+	Timeout         time.Duration // how long to wait for the file lock (0 waits indefinitely)
+	NoSync          bool          // skip fsync after each commit; faster, but a crash can lose recent commits
+	ReadOnly        bool          // open for reading only; write transactions fail
+	InitialMmapSize int           // initial size of the memory map in bytes, avoiding remaps as the file grows
+}
+
+// DBOptions are the options every database is opened with
+var DBOptions Options
+
+// lockPoll is how often a database opened with a context retries the
+// file lock, so a canceled context is noticed while waiting for it
+const lockPoll = 100 * time.Millisecond
+
+// OpenDB opens the database at path with 'DBOptions'
+func OpenDB(path string) (*bolt.DB, error) {
+	return openDB(path, DBOptions)
+}
+
+// openDB opens the database at path with the options o
+func openDB(path string, o Options) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0766, &bolt.Options{
+		Timeout:         o.Timeout,
+		ReadOnly:        o.ReadOnly,
+		InitialMmapSize: o.InitialMmapSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	db.NoSync = o.NoSync
+	return db, nil
+}
+
+// openDBContext opens the database at path with the options o, waiting
+// for another process's lock until o.Timeout elapses or ctx is done
+func openDBContext(ctx context.Context, path string, o Options) (*bolt.DB, error) {
+	start := time.Now()
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		try := o
+		try.Timeout = lockPoll
+		if o.Timeout > 0 {
+			left := o.Timeout - time.Since(start)
+			if left <= 0 {
+				return nil, bolt.ErrTimeout
+			}
+			if left < lockPoll {
+				try.Timeout = left
+			}
+		}
+		db, err := openDB(path, try)
+		if err != bolt.ErrTimeout {
+			return db, err
+		}
+	}
+}
+
+// ErrNoDatabase is returned when opening a database that doesn't exist
+// read-only
+var ErrNoDatabase = errors.New("database not found - run with -u first")
+
+// OpenDBReadOnly opens the database at path read-only with 'DBOptions', so
+// any number of processes can query it at once. A missing database fails
+// with 'ErrNoDatabase' rather than being opened, as BoltDB would create an
+// empty file it can't read.
+func OpenDBReadOnly(path string) (*bolt.DB, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s: %w", path, ErrNoDatabase)
+	}
+	return bolt.Open(path, 0766, &bolt.Options{
+		Timeout:         DBOptions.Timeout,
+		ReadOnly:        true,
+		InitialMmapSize: DBOptions.InitialMmapSize,
+	})
+}
@@ -0,0 +1,18 @@
+package xkcd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenDBReadOnlyMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "xkcd_index.db")
+	if _, err := OpenDBReadOnly(path); !errors.Is(err, ErrNoDatabase) {
+		t.Errorf("OpenDBReadOnly(missing) error = %v, want %v", err, ErrNoDatabase)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("OpenDBReadOnly(missing) created %s", path)
+	}
+}
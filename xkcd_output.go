@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/boltdb/bolt"
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// outputFormat is the format search results are printed in: "text"
+// (multi-line blocks), "table", "ndjson" or "rss"
+var outputFormat = "text"
+
+// showLinks adds a footer of related links to each text search result
+var showLinks bool
+
+// snippetLength is the maximum number of characters of the transcript
+// printed with each text search result (0 prints the whole transcript)
+var snippetLength = 200
+
+// snippetContext is the number of words shown either side of each query
+// term in a result's transcript snippet (0 shows the start of the transcript)
+var snippetContext int
+
+// mobileURL is the prefix of each comic's mobile page
+const mobileURL = "https://m.xkcd.com/"
+
+// resultTemplate formats each search result when set with -template
+var resultTemplate *template.Template
+
+// templateData is the value search result templates are executed with:
+// the comic's fields (ex: {{.Num}}, {{.Title}}, {{.Link}}) and its score
+type templateData struct {
+	xkcd.LogData
+	Score float64
+}
+
+// parseResultTemplate parses a search result template, adding a
+// trailing newline so each result is printed on its own line
+func parseResultTemplate(s string) (*template.Template, error) {
+	if !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	t, err := template.New("result").Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %v", err)
+	}
+	return t, nil
+}
+
+// printResults prints the results of query text with 'resultTemplate'
+// if set, or in 'outputFormat' otherwise
+func printResults(text string, results []Result) error {
+	if resultTemplate != nil {
+		for _, r := range results {
+			if err := resultTemplate.Execute(os.Stdout, templateData{r.Data, r.Score}); err != nil {
+				return fmt.Errorf("template failed: %v", err)
+			}
+		}
+		return nil
+	}
+	switch outputFormat {
+	case "text":
+	case "table":
+		printTable(results)
+		return nil
+	case "ndjson":
+		enc := json.NewEncoder(os.Stdout)
+		for _, r := range results {
+			if err := enc.Encode(resultRecord{newComicRecord(r.Data, nil), r.Score, r.Source}); err != nil {
+				return fmt.Errorf("JSON encoding failed: %s", err)
+			}
+		}
+		return nil
+	case "rss":
+		return writeRSS(os.Stdout, text, results)
+	default:
+		return usageErrorf("unknown output format: %q", outputFormat)
+	}
+
+	fmt.Println("results returned")
+	for _, r := range results {
+		v := r.Data
+		if len(searchSources) > 1 {
+			fmt.Printf("Source: %s\n", r.Source)
+		}
+		fmt.Printf("Num: %d\nTitle: %s\nTranscript: %s\nLink: %s\n",
+			v.Num, v.Title, snippet(v.Transcript, r.Matches), v.Link)
+		if showLinks {
+			printLinks(v)
+		}
+		if explainResults {
+			explain(r)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// snippet returns the part of transcript printed with a result: the words
+// within 'snippetContext' of each matched term, joined by ellipses, cut to
+// 'snippetLength' characters
+func snippet(transcript string, matches []termMatch) string {
+	s := strings.Join(strings.Fields(transcript), " ")
+	if snippetContext > 0 {
+		if c := contextWords(strings.Fields(s), matches); c != "" {
+			s = c
+		}
+	}
+	if snippetLength > 0 {
+		s = truncate(s, snippetLength)
+	}
+	return s
+}
+
+// contextWords returns the words within 'snippetContext' of the words
+// containing a matched term, merging overlapping windows
+func contextWords(words []string, matches []termMatch) string {
+	terms := make(map[string]bool)
+	for _, m := range matches {
+		terms[m.Term] = true
+	}
+	var parts []string
+	end := -1 // end of the current window
+	var cur []string
+	for i, w := range words {
+		hit := false
+		for _, t := range xkcd.Tokenize(w) {
+			if terms[t] {
+				hit = true
+				break
+			}
+		}
+		if !hit {
+			continue
+		}
+		from, to := i-snippetContext, i+snippetContext+1
+		if from < 0 {
+			from = 0
+		}
+		if to > len(words) {
+			to = len(words)
+		}
+		if cur != nil && from <= end {
+			cur = append(cur, words[end:to]...)
+		} else {
+			if cur != nil {
+				parts = append(parts, strings.Join(cur, " "))
+			}
+			cur = append([]string(nil), words[from:to]...)
+		}
+		if to > end {
+			end = to
+		}
+	}
+	if cur == nil {
+		return ""
+	}
+	parts = append(parts, strings.Join(cur, " "))
+	return strings.Join(parts, " … ")
+}
+
+// printLinks prints the permalink, mobile and explainxkcd links of d
+func printLinks(d xkcd.LogData) {
+	num := strconv.Itoa(int(d.Num))
+	fmt.Printf("  permalink: %s%s/  mobile: %s%s/  explain: %s%s\n",
+		xkcd.XKCDURL, num, mobileURL, num, explainURL, num)
+}
+
+// printTable prints search results as an aligned table of number, date,
+// title and link sized to the terminal width ($COLUMNS, default 80),
+// truncating titles that don't fit. Nothing is printed without results.
+func printTable(results []Result) {
+	if len(results) == 0 {
+		return
+	}
+	width, err := strconv.Atoi(os.Getenv("COLUMNS"))
+	if err != nil || width <= 0 {
+		width = 80
+	}
+	numW, dateW, linkW := len("num"), len("2006-01-02"), len("link")
+	for _, r := range results {
+		if n := len(strconv.Itoa(int(r.Data.Num))); n > numW {
+			numW = n
+		}
+		if n := len(r.Data.Link); n > linkW {
+			linkW = n
+		}
+	}
+	titleW := width - numW - dateW - linkW - 6 // 2 spaces between columns
+	if titleW < 10 {
+		titleW = 10
+	}
+
+	row := func(num, date, title, link string) {
+		fmt.Printf("%*s  %-*s  %s  %s\n", numW, num, dateW, date, padRight(truncate(title, titleW), titleW), link)
+	}
+	row("num", "date", "title", "link")
+	row(strings.Repeat("-", numW), strings.Repeat("-", dateW), strings.Repeat("-", titleW), strings.Repeat("-", linkW))
+	for _, r := range results {
+		d := r.Data
+		row(strconv.Itoa(int(d.Num)), comicDate(d), d.Title, d.Link)
+	}
+}
+
+// truncate shortens s to at most n runes, marking cut text with an ellipsis
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:n-1]) + "…"
+}
+
+// padRight pads s with spaces to n runes
+func padRight(s string, n int) string {
+	if c := utf8.RuneCountInString(s); c < n {
+		return s + strings.Repeat(" ", n-c)
+	}
+	return s
+}
+
+// resultRecord is a search result as written by '-format ndjson'
+type resultRecord struct {
+	comicRecord
+	Score  float64 `json:"score,omitempty"`
+	Source string  `json:"source,omitempty"`
+}
+
+// streamResults writes the comics in refs published within 'activePeriod'
+// as newline-delimited JSON as they are read from the index, without
+// buffering the result set. It returns the DocIDs of the results written,
+// which is never nil.
+func streamResults(refs []int) ([]int, error) {
+	db, err := openIndex(false)
+	if err != nil {
+		return nil, fmt.Errorf("db failed to open:\n%s", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	written := []int{}
+	t := xkcd.TraceTx("view", "data")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(xkcd.Bucket("data"))
+		if b == nil {
+			return indexErrorf("data index not found - run with -u first")
+		}
+		for _, v := range refs {
+			pb := b.Get(xkcd.Itob(v))
+			t.Get()
+			if pb == nil {
+				continue
+			}
+			d := decodeProto(pb)
+			if !activePeriod.contains(d) || !matchesFilters(d) {
+				continue
+			}
+			var fetchedAt *time.Time
+			if at, ok := xkcd.FetchedAt(tx, v); ok {
+				fetchedAt = &at
+			}
+			if err := enc.Encode(resultRecord{comicRecord: newComicRecord(d, fetchedAt)}); err != nil {
+				return fmt.Errorf("JSON encoding failed: %s", err)
+			}
+			written = append(written, v)
+		}
+		return nil
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		return written, fmt.Errorf("view op failed: %w", vErr)
+	}
+	return written, nil
+}
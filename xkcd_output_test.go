@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+func TestTruncate(t *testing.T) {
+	for _, c := range []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"Exploits of a Mom", 20, "Exploits of a Mom"},
+		{"Exploits of a Mom", 10, "Exploits …"},
+		{"Café Café", 5, "Café…"},
+	} {
+		if got := truncate(c.s, c.n); got != c.want {
+			t.Errorf("truncate(%q, %v) = %q, want %q", c.s, c.n, got, c.want)
+		}
+	}
+	if got := padRight("Café", 6); got != "Café  " {
+		t.Errorf("padRight(Café, 6) = %q", got)
+	}
+}
+
+func TestPrintTable(t *testing.T) {
+	columns := os.Getenv("COLUMNS")
+	defer os.Setenv("COLUMNS", columns)
+	os.Setenv("COLUMNS", "60")
+	results := []Result{
+		{Data: xkcd.LogData{Num: 327, Year: "2007", Month: "10", Day: "10", Title: "Exploits of a Mom", Link: "https://xkcd.com/327"}},
+		{Data: xkcd.LogData{Num: 1, Year: "2006", Month: "1", Day: "1", Title: "Barrel - Part 1 and a much longer title", Link: "https://xkcd.com/1"}},
+	}
+
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	printTable(results)
+	w.Close()
+	os.Stdout = stdout
+	out, _ := ioutil.ReadAll(r)
+
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("printed %d lines, want 4:\n%s", len(lines), out)
+	}
+	for _, l := range lines {
+		if n := utf8.RuneCountInString(l); n > 60 {
+			t.Errorf("line is %d columns wide, want at most 60: %q", n, l)
+		}
+	}
+	if !strings.HasPrefix(lines[3], "  1  2006-01-01  Barrel") || !strings.Contains(lines[3], "…  https://xkcd.com/1") {
+		t.Errorf("row = %q, want a truncated title between date and link", lines[3])
+	}
+}
+
+func TestPrintTableEmpty(t *testing.T) {
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	printTable(nil)
+	w.Close()
+	os.Stdout = stdout
+	if out, _ := ioutil.ReadAll(r); len(out) > 0 {
+		t.Errorf("printTable(nil) printed %q, want nothing", out)
+	}
+}
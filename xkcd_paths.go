@@ -0,0 +1,200 @@
+package xkcd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// File names of the databases, kept in 'DataDir'
+const (
+	IndexFile = "xkcd_index.db"
+	LogDBFile = "log.db"
+)
+
+// DataDir is the directory the databases and the comic log are kept in:
+// $XDG_DATA_HOME/xkcd or ~/.local/share/xkcd, or the user config directory
+// on Windows and macOS. "" uses the working directory.
+var DataDir = defaultDataDir()
+
+// CacheDir is the directory downloaded images and thumbnails are cached
+// in, 'xkcd' in the user cache directory. "" uses the working directory.
+var CacheDir = defaultCacheDir()
+
+func defaultDataDir() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "xkcd")
+	}
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" || runtime.GOOS == "plan9" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return ""
+		}
+		return filepath.Join(dir, "xkcd")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".local", "share", "xkcd")
+}
+
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "xkcd")
+}
+
+// IndexPath returns the path of 'xkcd_index.db'
+func IndexPath() string {
+	return filepath.Join(DataDir, IndexFile)
+}
+
+// LogDBPath returns the path of 'log.db'
+func LogDBPath() string {
+	return filepath.Join(DataDir, LogDBFile)
+}
+
+// legacyCache maps the image cache of earlier versions, kept in the
+// working directory, to its name in 'CacheDir'
+var legacyCache = map[string]string{"xkcd_images": "images"}
+
+// ErrMigrate is wrapped by the error 'PreparePaths' returns when files
+// couldn't be moved into the data and cache directories
+var ErrMigrate = errors.New("migration failed")
+
+// PreparePaths creates 'DataDir' and 'CacheDir'. With migrate set, the
+// databases, logs and image cache that earlier versions kept in the
+// working directory are moved into them, unless a file of the same name
+// is already there; the moved paths are returned. Once moved, the files
+// are no longer found in the working directory, so migration only
+// happens once. Files that can't be moved are left in place and reported
+// by an error wrapping 'ErrMigrate', after the others are moved.
+func PreparePaths(migrate bool) ([]string, error) {
+	for _, dir := range []string{DataDir, CacheDir} {
+		if dir == "" {
+			continue
+		}
+		if err := Files.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	if !migrate {
+		return nil, nil
+	}
+
+	moves := make(map[string]string)
+	names := []string{IndexFile, LogDBFile, "comic_log.jsonl", "comic_log.txt"}
+	files, err := Files.ReadDir(".")
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range files {
+		if logSeq(fi.Name()) > 0 {
+			names = append(names, fi.Name())
+		}
+	}
+	for _, name := range names {
+		moves[name] = filepath.Join(DataDir, name)
+	}
+	for old, name := range legacyCache {
+		moves[old] = filepath.Join(CacheDir, name)
+	}
+
+	var moved, failed []string
+	for old, dst := range moves {
+		if sameFile(old, dst) {
+			continue
+		}
+		if _, err := Files.Stat(old); err != nil {
+			continue
+		}
+		if _, err := Files.Stat(dst); err == nil {
+			continue // never overwrite newer data
+		}
+		if err := moveFile(old, dst); err != nil {
+			failed = append(failed, err.Error())
+			continue
+		}
+		moved = append(moved, old+" -> "+dst)
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return moved, fmt.Errorf("%w:\n%s", ErrMigrate, strings.Join(failed, "\n"))
+	}
+	return moved, nil
+}
+
+// moveFile renames old to dst. Rename can't cross filesystems, so when
+// the working directory and dst are on different ones old is copied, a
+// directory recursively, and removed once copied.
+func moveFile(old, dst string) error {
+	err := Files.Rename(old, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	fi, err := Files.Stat(old)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		if err := copyFile(old, dst, fi.Mode().Perm()); err != nil {
+			return err
+		}
+		return Files.Remove(old)
+	}
+	if err := Files.MkdirAll(dst, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	entries, err := Files.ReadDir(old)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := moveFile(filepath.Join(old, e.Name()), filepath.Join(dst, e.Name())); err != nil {
+			return err
+		}
+	}
+	return Files.Remove(old)
+}
+
+// copyFile copies the file src to the new file dst, removing dst if the
+// copy fails
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := Files.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := Files.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cErr := out.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		Files.Remove(dst)
+		return fmt.Errorf("copy %s to %s failed: %w", src, dst, err)
+	}
+	return nil
+}
+
+// sameFile reports whether paths a and b name the same location
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
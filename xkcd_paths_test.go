@@ -0,0 +1,96 @@
+package xkcd
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// crossDevice fails every rename as if the paths were on different
+// filesystems
+type crossDevice struct{ OSFS }
+
+func (crossDevice) Rename(oldpath, newpath string) error {
+	return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+}
+
+func TestPreparePathsCrossDevice(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	files, dataDir, cacheDir := Files, DataDir, CacheDir
+	defer func() { Files, DataDir, CacheDir = files, dataDir, cacheDir }()
+
+	legacy := t.TempDir()
+	if err := os.Chdir(legacy); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(IndexFile, []byte("index"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir("xkcd_images", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join("xkcd_images", "327.png"), []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	Files, DataDir, CacheDir = crossDevice{}, t.TempDir(), t.TempDir()
+
+	moved, err := PreparePaths(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moved) != 2 {
+		t.Errorf("moved %v, want the index and the image cache", moved)
+	}
+	for path, want := range map[string]string{
+		IndexPath(): "index",
+		filepath.Join(CacheDir, "images", "327.png"): "png",
+	} {
+		if b, err := ioutil.ReadFile(path); err != nil || string(b) != want {
+			t.Errorf("%s = %q, %v, want %q", path, b, err, want)
+		}
+	}
+	for _, old := range []string{IndexFile, "xkcd_images"} {
+		if _, err := os.Stat(old); !os.IsNotExist(err) {
+			t.Errorf("%s left in the working directory", old)
+		}
+	}
+}
+
+// readOnlyFS fails every rename with a permission error
+type readOnlyFS struct{ OSFS }
+
+func (readOnlyFS) Rename(oldpath, newpath string) error {
+	return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EACCES}
+}
+
+func TestPreparePathsFailedMove(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	files, dataDir, cacheDir := Files, DataDir, CacheDir
+	defer func() { Files, DataDir, CacheDir = files, dataDir, cacheDir }()
+
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(IndexFile, []byte("index"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	Files, DataDir, CacheDir = readOnlyFS{}, t.TempDir(), t.TempDir()
+
+	if _, err := PreparePaths(true); !errors.Is(err, ErrMigrate) {
+		t.Errorf("PreparePaths error = %v, want %v", err, ErrMigrate)
+	}
+	if _, err := os.Stat(IndexFile); err != nil {
+		t.Errorf("%s not left in place: %v", IndexFile, err)
+	}
+}
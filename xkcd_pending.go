@@ -0,0 +1,148 @@
+package xkcd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+// PendingMap stores the error of each comic that failed to download
+// during an update, to be retried on the next update
+var PendingMap = make(map[int]string)
+
+// storePending adds the comics in m to the 'pending' bucket
+func storePending(m map[int]string) error {
+	db, err := OpenDB(IndexPath())
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+	defer db.Close()
+
+	t := TraceTx("update", "pending")
+	uErr := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(Bucket("pending"))
+		if err != nil {
+			return fmt.Errorf("create 'pending' bucket failed:\n%s", err)
+		}
+		for k, v := range m {
+			if err := b.Put(Itob(k), []byte(v)); err != nil {
+				return fmt.Errorf("put failed:\n%s", err)
+			}
+			t.Put(Itob(k), []byte(v))
+		}
+		return nil
+	})
+	t.Done(uErr)
+	if uErr != nil {
+		return fmt.Errorf("update transaction failed:\n%w", uErr)
+	}
+	return nil
+}
+
+// readPending returns the comics queued for retry and the error each last failed with
+func readPending() (map[int]string, error) {
+	pending := make(map[int]string)
+	db, err := OpenDB(IndexPath())
+	if err != nil {
+		return nil, fmt.Errorf("db failed to open:\n%s", err)
+	}
+	defer db.Close()
+
+	t := TraceTx("view", "pending")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(Bucket("pending"))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			t.Get()
+			pending[Btoi(k)] = string(v)
+			return nil
+		})
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		return nil, fmt.Errorf("view op failed: %w", vErr)
+	}
+	return pending, nil
+}
+
+// RetryPending re-requests the comics in the 'pending' bucket, indexing
+// and removing each one that downloads. Comics that fail again with a
+// network error stay queued with their new error; those that no longer
+// exist or fail otherwise are recorded in LastRun and unqueued.
+func RetryPending() error {
+	pending, err := readPending()
+	if err != nil || len(pending) == 0 {
+		return err
+	}
+	fmt.Printf("retrying %v pending comics...\n", len(pending))
+
+	db, err := OpenDB(IndexPath())
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+	defer db.Close()
+
+	for num := range pending {
+		respInfo, ok, rErr := fetchInfo(num)
+		var netErr *NetworkError
+		if errors.As(rErr, &netErr) {
+			fmt.Printf("file failed: %v (%v)\n", num, rErr)
+			pending[num] = rErr.Error()
+			LastRun.Failed[num] = rErr.Error()
+			noteFailure(num, "retry", rErr)
+			continue
+		}
+		if rErr == nil && ok {
+			_, _, rErr = replaceComic(db, num, respInfo)
+		}
+		switch {
+		case rErr != nil: // not worth retrying again; record and unqueue
+			fmt.Printf("file failed: %v (%v)\n", num, rErr)
+			LastRun.Failed[num] = rErr.Error()
+			noteFailure(num, "retry", rErr)
+		case !ok: // comic no longer exists
+			fmt.Printf("file skipped: %v\n", num)
+			LastRun.Skipped = append(LastRun.Skipped, num)
+		default:
+			fmt.Printf("file refetched: %v\n", num)
+			LastRun.Retried++
+			LastRun.Bytes += int64(len(respInfo))
+		}
+		delete(pending, num)
+
+		t := TraceTx("update", "pending")
+		uErr := db.Update(func(tx *bolt.Tx) error {
+			t.Delete()
+			return tx.Bucket(Bucket("pending")).Delete(Itob(num))
+		})
+		t.Done(uErr)
+		if uErr != nil {
+			return fmt.Errorf("update transaction failed:\n%w", uErr)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	// record the latest error of comics still pending
+	t := TraceTx("update", "pending")
+	uErr := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(Bucket("pending"))
+		for k, v := range pending {
+			if err := b.Put(Itob(k), []byte(v)); err != nil {
+				return fmt.Errorf("put failed:\n%s", err)
+			}
+			t.Put(Itob(k), []byte(v))
+		}
+		return nil
+	})
+	t.Done(uErr)
+	if uErr != nil {
+		return fmt.Errorf("update transaction failed:\n%w", uErr)
+	}
+	fmt.Printf("comics still pending: %v\n", len(pending))
+	return nil
+}
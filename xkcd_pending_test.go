@@ -0,0 +1,37 @@
+package xkcd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRetryPendingUnqueues(t *testing.T) {
+	dataDir, replayDir := DataDir, ReplayDir
+	defer func() { DataDir, ReplayDir = dataDir, replayDir }()
+	DataDir, ReplayDir = t.TempDir(), t.TempDir()
+	if err := writeFile(capturePath(ReplayDir, 8), []byte("not json"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := storePending(map[int]string{7: "timeout", 8: "timeout"}); err != nil {
+		t.Fatal(err)
+	}
+	startRun()
+
+	// 7 has no captured info (a 404), 8 fails to index
+	if err := RetryPending(); err != nil {
+		t.Fatalf("RetryPending() = %v, want nil", err)
+	}
+	if !reflect.DeepEqual(LastRun.Skipped, []int{7}) {
+		t.Errorf("Skipped = %v, want [7]", LastRun.Skipped)
+	}
+	if _, ok := LastRun.Failed[8]; !ok || len(LastRun.Failed) != 1 {
+		t.Errorf("Failed = %v, want only 8", LastRun.Failed)
+	}
+	pending, err := readPending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("pending = %v, want empty", pending)
+	}
+}
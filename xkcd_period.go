@@ -0,0 +1,160 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// activePeriod restricts commands to comics published in a period (nil for all)
+var activePeriod *period
+
+// period is an inclusive range of publication months as 'YYYY-MM' keys
+type period struct {
+	From, To string
+}
+
+// parsePeriod parses a year ('2015'), month ('2015-03'), or inclusive
+// range of either ('2014:2016', '2015-06:2016-02')
+func parsePeriod(s string) (*period, error) {
+	from, to := s, s
+	if i := strings.Index(s, ":"); i >= 0 {
+		from, to = s[:i], s[i+1:]
+	}
+	f, err := periodKey(from, "01")
+	if err != nil {
+		return nil, fmt.Errorf("invalid period %q: %v", s, err)
+	}
+	t, err := periodKey(to, "12")
+	if err != nil {
+		return nil, fmt.Errorf("invalid period %q: %v", s, err)
+	}
+	if t < f {
+		return nil, fmt.Errorf("invalid period %q: end before start", s)
+	}
+	return &period{f, t}, nil
+}
+
+// periodKey converts 'YYYY' or 'YYYY-MM' to a 'YYYY-MM' key, using
+// month when none is given
+func periodKey(s, month string) (string, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) > 2 {
+		return "", fmt.Errorf("expected YYYY or YYYY-MM")
+	}
+	y, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts[0]) != 4 {
+		return "", fmt.Errorf("bad year %q", parts[0])
+	}
+	if len(parts) == 2 {
+		month = parts[1]
+	}
+	m, err := strconv.Atoi(month)
+	if err != nil || m < 1 || m > 12 {
+		return "", fmt.Errorf("bad month %q", month)
+	}
+	return fmt.Sprintf("%04d-%02d", y, m), nil
+}
+
+// monthKey returns the 'YYYY-MM' publication month of d
+func monthKey(d xkcd.LogData) string {
+	y, _ := strconv.Atoi(d.Year)
+	m, _ := strconv.Atoi(d.Month)
+	return fmt.Sprintf("%04d-%02d", y, m)
+}
+
+// comicDate returns the 'YYYY-MM-DD' publication date of d
+func comicDate(d xkcd.LogData) string {
+	day, _ := strconv.Atoi(d.Day)
+	return fmt.Sprintf("%s-%02d", monthKey(d), day)
+}
+
+// contains reports whether d was published within p; a nil period contains every comic
+func (p *period) contains(d xkcd.LogData) bool {
+	if p == nil {
+		return true
+	}
+	k := monthKey(d)
+	return k >= p.From && k <= p.To
+}
+
+// years returns the publication years p covers (ex: "2014", "2015")
+func (p *period) years() []string {
+	from, _ := strconv.Atoi(p.From[:4])
+	to, _ := strconv.Atoi(p.To[:4])
+	var ys []string
+	for y := from; y <= to; y++ {
+		ys = append(ys, strconv.Itoa(y))
+	}
+	return ys
+}
+
+// filterPeriod returns the comics in data published within 'activePeriod'
+func filterPeriod(data []xkcd.LogData) []xkcd.LogData {
+	if activePeriod == nil {
+		return data
+	}
+	var in []xkcd.LogData
+	for _, d := range data {
+		if activePeriod.contains(d) {
+			in = append(in, d)
+		}
+	}
+	return in
+}
+
+// periodDocs returns the DocIDs of the comics published within 'activePeriod'
+func periodDocs(db *bolt.DB) (map[int]bool, error) {
+	docs := make(map[int]bool)
+	err := eachComic(db, func(d xkcd.LogData) {
+		docs[int(d.Num)] = true
+	})
+	return docs, err
+}
+
+// periodCounts reports the number of comics indexed per year and per
+// month ('xkcd periods -months')
+func periodCounts(args []string) error {
+	fs := flag.NewFlagSet("periods", flag.ExitOnError)
+	months := fs.Bool("months", false, "also count comics per month")
+	fs.Parse(args)
+
+	if err := checkIndex(); err != nil {
+		return err
+	}
+	db, err := openIndex(false)
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+
+	years, monthly := make(map[string]int), make(map[string]int)
+	total := 0
+	err = eachComic(db, func(d xkcd.LogData) {
+		years[d.Year]++
+		monthly[monthKey(d)]++
+		total++
+	})
+	if err != nil {
+		return err
+	}
+
+	counts := years
+	if *months {
+		counts = monthly
+	}
+	var keys []string
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Printf("%s\t%5d\n", k, counts[k])
+	}
+	fmt.Printf("\nTotal comics: %v\n", total)
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	_ "net/http/pprof" // registers /debug/pprof handlers
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// startProfile starts CPU profiling to cpuFile and/or the pprof HTTP
+// endpoint on addr. The returned func stops CPU profiling and writes
+// the heap profile to memFile; it must be called before exiting.
+func startProfile(cpuFile, memFile, addr string) (func(), error) {
+	if addr != "" {
+		go func() {
+			if err := http.ListenAndServe(addr, nil); err != nil {
+				fmt.Printf("pprof endpoint failed: %v\n", err)
+			}
+		}()
+		fmt.Printf("pprof endpoint at http://%s/debug/pprof/\n", addr)
+	}
+
+	var cpu *os.File
+	if cpuFile != "" {
+		f, err := os.Create(cpuFile)
+		if err != nil {
+			return nil, fmt.Errorf("create cpu profile failed: %v", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("start cpu profile failed: %v", err)
+		}
+		cpu = f
+	}
+
+	stop := func() {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			cpu.Close()
+		}
+		if memFile == "" {
+			return
+		}
+		f, err := os.Create(memFile)
+		if err != nil {
+			fmt.Printf("create memory profile failed: %v\n", err)
+			return
+		}
+		defer f.Close()
+		runtime.GC() // get up-to-date statistics
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			fmt.Printf("write memory profile failed: %v\n", err)
+		}
+	}
+	return stop, nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// progressEvery is the number of comics between the progress lines
+// printed by updates
+const progressEvery = 25
+
+// printProgress prints an update's progress every 'progressEvery' comics
+// and after the last one, with the time remaining estimated from the
+// latest comic number the update is bounded by
+func printProgress(p xkcd.Progress) {
+	if p.Done%progressEvery != 0 && p.Done != p.Total {
+		return
+	}
+	var eta time.Duration
+	if p.Done > 0 {
+		eta = p.Elapsed / time.Duration(p.Done) * time.Duration(p.Total-p.Done)
+	}
+	fmt.Printf("progress: %v/%v comics (%.0f%%), %v failed, ETA %v\n",
+		p.Done, p.Total, 100*float64(p.Done)/float64(p.Total), p.Failed, eta.Round(time.Second))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"sort"
+
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// proximityWeight scales the boost given to results whose query terms
+// occur close together in the transcript (0 disables the boost)
+var proximityWeight = 1.0
+
+// termPos is the position of a query term in a tokenized field
+type termPos struct {
+	Pos  int
+	Term int // index of the term in the query
+}
+
+// proximity returns the number of distinct query terms found in the
+// transcript of d and the length, in terms, of the shortest window of
+// the transcript containing all of them. Term positions are derived
+// from the stored transcript at query time.
+func proximity(d xkcd.LogData, query []string) (matched, window int) {
+	idx := make(map[string]int)
+	for _, t := range query {
+		if _, ok := idx[t]; !ok {
+			idx[t] = len(idx)
+		}
+	}
+	var positions []termPos
+	for i, t := range xkcd.Tokenize(d.Transcript) {
+		if q, ok := idx[t]; ok {
+			positions = append(positions, termPos{i, q})
+		}
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i].Pos < positions[j].Pos })
+
+	found := make(map[int]bool)
+	for _, p := range positions {
+		found[p.Term] = true
+	}
+	matched = len(found)
+	if matched < 2 {
+		return matched, 0
+	}
+
+	// slide a window over the positions, shrinking it from the left
+	// whenever it contains every matched term
+	counts := make(map[int]int)
+	have, left := 0, 0
+	for _, p := range positions {
+		if counts[p.Term] == 0 {
+			have++
+		}
+		counts[p.Term]++
+		for have == matched {
+			w := p.Pos - positions[left].Pos + 1
+			if window == 0 || w < window {
+				window = w
+			}
+			l := positions[left].Term
+			counts[l]--
+			if counts[l] == 0 {
+				have--
+			}
+			left++
+		}
+	}
+	return matched, window
+}
+
+// proximityBoost returns the factor a result's score is multiplied by:
+// 1 + weight * matched / window, so adjacent terms double the score at
+// the default weight and distant terms barely change it
+func proximityBoost(matched, window int) float64 {
+	if matched < 2 || window == 0 {
+		return 1
+	}
+	return 1 + proximityWeight*float64(matched)/float64(window)
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// infoJSON is a comic in the format of xkcd.com's JSON info
+type infoJSON struct {
+	Month      string `json:"month"`
+	Num        int32  `json:"num"`
+	Link       string `json:"link"`
+	Year       string `json:"year"`
+	News       string `json:"news"`
+	SafeTitle  string `json:"safe_title"`
+	Transcript string `json:"transcript"`
+	Alt        string `json:"alt"`
+	Img        string `json:"img"`
+	Title      string `json:"title"`
+	Day        string `json:"day"`
+}
+
+// newInfoJSON converts stored LogData to xkcd.com's format
+func newInfoJSON(d xkcd.LogData) infoJSON {
+	link := d.Link
+	if link == xkcd.XKCDURL+strconv.Itoa(int(d.Num)) {
+		link = "" // set by the indexer - empty in xkcd.com's info
+	}
+	safeTitle := d.SafeTitle
+	if safeTitle == "" {
+		safeTitle = d.Title
+	}
+	return infoJSON{d.Month, d.Num, link, d.Year, d.News, safeTitle,
+		d.Transcript, d.Alt, d.Img, d.Title, d.Day}
+}
+
+// proxy serves xkcd.com's JSON info endpoints from the index
+type proxy struct {
+	mu    sync.Mutex // serializes database access of requests
+	token string     // admin bearer token; admin endpoints are off when empty
+	args  []string   // global flags the proxy was started with, for jobs
+
+	defaultIndex string            // namespace of requests that don't name one
+	tenants      map[string]string // data directory of each namespace served
+
+	jobsMu  sync.Mutex
+	jobs    map[string]*job
+	nsJobs  map[string]*sync.Mutex // held by the running job of each namespace
+	lastJob int
+
+	schedMu sync.Mutex
+	stops   []chan struct{} // stop the running scheduled updates
+}
+
+// tenantKey is the request context key of the namespace a request is for
+type tenantKey struct{}
+
+// tenant returns the namespace r is for
+func tenant(r *http.Request) string {
+	return r.Context().Value(tenantKey{}).(string)
+}
+
+// withDB runs fn with the index of namespace ns open for writing. The
+// index is only held open for one request at a time, so jobs can open it
+// themselves.
+func (p *proxy) withDB(ns string, fn func(db *bolt.DB) error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer func(ns, dir string) { xkcd.Namespace, xkcd.DataDir = ns, dir }(xkcd.Namespace, xkcd.DataDir)
+	xkcd.Namespace, xkcd.DataDir = ns, p.tenants[ns]
+	db, err := xkcd.OpenDB(xkcd.IndexPath())
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+	defer db.Close()
+	return fn(db)
+}
+
+// proxyComics serves '/info.0.json' and '/NNN/info.0.json' from the
+// index, downloading and indexing comics that aren't stored yet, the
+// cached thumbnails at '/NNN/thumb.png', a bulk export of every comic at
+// '/export', and the admin endpoints, for the -index namespace and each
+// of -tenants, which keep their own databases in 'tenantDir'
+// ('xkcd proxy -addr localhost:8080 -token secret -tenants whatif')
+func proxyComics(args []string) error {
+	fs := flag.NewFlagSet("proxy", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:8080", "`address` to listen on")
+	token := fs.String("token", os.Getenv("XKCD_ADMIN_TOKEN"), "bearer `token` required by the admin endpoints (default $XKCD_ADMIN_TOKEN; admin endpoints are off when empty)")
+	tenants := fs.String("tenants", "", "comma-separated index `namespaces` to serve under '/ns/<name>/' besides -index, each with its own databases in <datadir>/tenants/<name> (ex: whatif,team-a)")
+	schedule := fs.String("schedule", "", "update each namespace periodically as name=interval pairs (ex: default=1h,whatif=24h)")
+	fs.Parse(args)
+
+	p := &proxy{
+		token:        *token,
+		args:         os.Args[1 : len(os.Args)-flag.NArg()],
+		defaultIndex: xkcd.Namespace,
+		tenants:      map[string]string{xkcd.Namespace: xkcd.DataDir},
+		jobs:         make(map[string]*job),
+		nsJobs:       make(map[string]*sync.Mutex),
+	}
+	if *tenants != "" {
+		for _, ns := range strings.Split(*tenants, ",") {
+			if ns == "" || ns == "." || ns == ".." || strings.ContainsAny(ns, `/\`) {
+				return usageErrorf("invalid index name: %q", ns)
+			}
+			if ns == p.defaultIndex {
+				continue
+			}
+			dir := tenantDir(ns)
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return fmt.Errorf("create tenant dir failed: %v", err)
+			}
+			p.tenants[ns] = dir
+		}
+	}
+	explicit := false
+	fs.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "schedule" })
+	if !explicit {
+		*schedule = activeConfig.Schedule
+	}
+	intervals, err := parseSchedule(*schedule, p.tenants)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", p)
+	mux.HandleFunc("/export", p.serveExport)
+	mux.HandleFunc("/admin/update", p.admin(p.startJob("update")))
+	mux.HandleFunc("/admin/reindex", p.admin(p.startJob("reindex")))
+	mux.HandleFunc("/admin/jobs/", p.admin(p.serveJob))
+	p.schedule(intervals)
+	go p.reload(explicit)
+	fmt.Printf("serving xkcd JSON info on http://%s/\n", *addr)
+	return http.ListenAndServe(*addr, p.route(mux))
+}
+
+// route resolves the namespace of each request, named by a '/ns/<name>'
+// path prefix or an 'X-Xkcd-Index' header, and passes it on to next with
+// the prefix removed
+func (p *proxy) route(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ns := p.defaultIndex
+		if h := r.Header.Get("X-Xkcd-Index"); h != "" {
+			ns = h
+		}
+		u := *r.URL
+		if rest := strings.TrimPrefix(u.Path, "/ns/"); rest != u.Path {
+			i := strings.Index(rest, "/")
+			if i < 0 {
+				http.NotFound(w, r)
+				return
+			}
+			ns, u.Path = rest[:i], rest[i:]
+		}
+		if _, ok := p.tenants[ns]; !ok {
+			http.Error(w, fmt.Sprintf("unknown index %q", ns), http.StatusNotFound)
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), tenantKey{}, ns))
+		r.URL = &u
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tenantDir returns the data directory of tenant ns, 'tenants/<ns>' in
+// 'xkcd.DataDir'
+func tenantDir(ns string) string {
+	return filepath.Join(xkcd.DataDir, "tenants", ns)
+}
+
+// parseSchedule parses name=interval pairs of namespaces in tenants
+func parseSchedule(s string, tenants map[string]string) (map[string]time.Duration, error) {
+	intervals := make(map[string]time.Duration)
+	if s == "" {
+		return intervals, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		_, served := tenants[kv[0]]
+		if len(kv) != 2 || !served {
+			return nil, usageErrorf("invalid schedule %q: expected name=interval for a served index", pair)
+		}
+		d, err := time.ParseDuration(kv[1])
+		if err != nil || d <= 0 {
+			return nil, usageErrorf("invalid schedule %q: bad interval", pair)
+		}
+		intervals[kv[0]] = d
+	}
+	return intervals, nil
+}
+
+// schedule replaces the scheduled updates with updates of each namespace
+// every interval in intervals
+func (p *proxy) schedule(intervals map[string]time.Duration) {
+	p.schedMu.Lock()
+	defer p.schedMu.Unlock()
+	for _, stop := range p.stops {
+		close(stop)
+	}
+	p.stops = nil
+	for ns, d := range intervals {
+		stop := make(chan struct{})
+		p.stops = append(p.stops, stop)
+		go p.scheduleUpdates(ns, d, stop)
+	}
+}
+
+// scheduleUpdates starts an update job for namespace ns every interval
+// until stop is closed
+func (p *proxy) scheduleUpdates(ns string, interval time.Duration, stop chan struct{}) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			p.runJob("update", ns)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// reload applies each reloaded config between requests,
+// rescheduling updates unless -schedule was given
+func (p *proxy) reload(explicitSchedule bool) {
+	for c := range configReloads() {
+		if !explicitSchedule {
+			if _, err := parseSchedule(c.Schedule, p.tenants); err != nil {
+				fmt.Fprintf(os.Stderr, "%s config reload failed: %v\n", time.Now().Format(time.RFC3339), err)
+				continue
+			}
+		}
+		p.mu.Lock()
+		ok := reloadConfig(c)
+		p.mu.Unlock()
+		if !ok || explicitSchedule {
+			continue
+		}
+		intervals, _ := parseSchedule(c.Schedule, p.tenants)
+		p.schedule(intervals)
+	}
+}
+
+// ServeHTTP serves the JSON info of the comic named by the request path
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	path := strings.Trim(r.URL.Path, "/")
+	if strings.HasSuffix(path, "/thumb.png") {
+		p.serveThumb(w, r, strings.TrimSuffix(path, "/thumb.png"))
+		return
+	}
+	if !strings.HasSuffix(path, "info.0.json") {
+		http.NotFound(w, r)
+		return
+	}
+	path = strings.TrimSuffix(strings.TrimSuffix(path, "info.0.json"), "/")
+
+	var d xkcd.LogData
+	var ok bool
+	var err error
+	err = p.withDB(tenant(r), func(db *bolt.DB) error {
+		var err error
+		if path == "" {
+			d, ok, err = xkcd.CachedLatest(db)
+		} else if num, aErr := strconv.Atoi(path); aErr == nil && num > 0 {
+			d, ok, err = xkcd.CachedComic(db, num)
+		}
+		return err
+	})
+	if err != nil {
+		log.Printf("proxy %s: %v", r.URL.Path, err)
+		http.Error(w, "upstream request failed", http.StatusBadGateway)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newInfoJSON(d))
+}
+
+// serveThumb serves the cached thumbnail of comic path, generating it
+// from the cached image when it's missing
+func (p *proxy) serveThumb(w http.ResponseWriter, r *http.Request, path string) {
+	num, err := strconv.Atoi(path)
+	if err != nil || num < 1 {
+		http.NotFound(w, r)
+		return
+	}
+	if _, err := os.Stat(thumbFile(num)); os.IsNotExist(err) {
+		matches, _ := filepath.Glob(filepath.Join(imageCacheDir, strconv.Itoa(num)+"-*"))
+		if len(matches) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		if err := makeThumb(num, matches[0]); err != nil {
+			log.Printf("proxy %s: %v", r.URL.Path, err)
+			http.Error(w, "thumbnail failed", http.StatusInternalServerError)
+			return
+		}
+	}
+	http.ServeFile(w, r, thumbFile(num))
+}
+
+// serveExport streams a tar.gz of every stored comic as 'comics/NNN.json'
+// in xkcd.com's format and, with '?images=1', the cached images as
+// 'images/NNN-name'
+func (p *proxy) serveExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	images := r.URL.Query().Get("images")
+	withImages := images == "1" || images == "true"
+
+	// the comics are read first, so the index isn't held while a slow
+	// client downloads the export
+	var comics []xkcd.LogData
+	err := p.withDB(tenant(r), func(db *bolt.DB) error {
+		return eachComic(db, func(d xkcd.LogData) { comics = append(comics, d) })
+	})
+	if err != nil {
+		log.Printf("export failed: %v", err)
+		http.Error(w, "export failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="xkcd-export.tar.gz"`)
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+
+	// the response has started, so errors can only be logged
+	for _, d := range comics {
+		b, err := json.Marshal(newInfoJSON(d))
+		if err == nil {
+			name := fmt.Sprintf("comics/%d.json", d.Num)
+			err = writeTarFile(tw, name, int64(len(b)), now, bytes.NewReader(b))
+		}
+		if err == nil && withImages && d.Img != "" {
+			err = writeTarImage(tw, imageFile(int(d.Num), d.Img))
+		}
+		if err != nil {
+			log.Printf("export failed: %v", err)
+			return
+		}
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	if err != nil {
+		log.Printf("export failed: %v", err)
+	}
+}
+
+// writeTarFile adds a file named name with size bytes read from r to tw
+func writeTarFile(tw *tar.Writer, name string, size int64, mod time.Time, r io.Reader) error {
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: size, ModTime: mod}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := io.Copy(tw, r)
+	return err
+}
+
+// writeTarImage adds the cached image file to tw, skipping images that
+// aren't cached
+func writeTarImage(tw *tar.Writer, file string) error {
+	f, err := os.Open(filepath.Join(imageCacheDir, file))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return writeTarFile(tw, "images/"+file, fi.Size(), fi.ModTime(), f)
+}
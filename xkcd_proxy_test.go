@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tenants := map[string]string{"default": "", "whatif": "tenants/whatif"}
+	got, err := parseSchedule("default=1h,whatif=24h", tenants)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["default"] != time.Hour || got["whatif"] != 24*time.Hour {
+		t.Errorf("parseSchedule() = %v", got)
+	}
+	for _, s := range []string{"blag=1h", "whatif", "whatif=soon", "whatif=-1h"} {
+		if _, err := parseSchedule(s, tenants); exitCode(err) != exitUsage {
+			t.Errorf("parseSchedule(%q) error = %v, want a usage error", s, err)
+		}
+	}
+}
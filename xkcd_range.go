@@ -0,0 +1,100 @@
+package xkcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+// FetchRange downloads comics from through to with up to 'FetchWorkers'
+// concurrent requests and stores and indexes them, replacing those
+// already indexed, without crawling the rest of the archive. The range
+// is bounded by the latest comic. Comics that fail to download are
+// queued for the next update, and when the range covers the next comic
+// an update would download, the next update resumes after it. It
+// returns the number of comics indexed.
+func FetchRange(from, to int) (n int, err error) {
+	if from < 1 || to < from {
+		return 0, fmt.Errorf("invalid range: %v-%v", from, to)
+	}
+	defer flushFailures() // after the database is closed
+	GetIndex()
+	latest, err := latestNum()
+	if err != nil {
+		return 0, err
+	}
+	if to > latest {
+		to = latest
+	}
+	if from > to {
+		return 0, fmt.Errorf("range starts after the latest comic (%v)", latest)
+	}
+
+	db, err := OpenDB(IndexPath())
+	if err != nil {
+		return 0, fmt.Errorf("db failed to open:\n%s", err)
+	}
+	n, pending, fErr := fetchRange(db, from, to)
+	db.Close()
+	if len(pending) > 0 {
+		if err := storePending(pending); err != nil {
+			return n, fmt.Errorf("storePending failed: %v", err)
+		}
+		fmt.Printf("failed comics queued for retry: %v\n", len(pending))
+	}
+	if fErr != nil {
+		return n, fErr
+	}
+	if from <= Index && Index <= to {
+		Index = to + 1
+		if err := logIndexVar(Index); err != nil {
+			return n, fmt.Errorf("logIndexVar failed: %v", err)
+		}
+	}
+	return n, nil
+}
+
+// fetchRange indexes comics from through to in db in order, returning
+// the number indexed and the errors of those that failed to download
+func fetchRange(db *bolt.DB, from, to int) (n int, pending map[int]string, err error) {
+	t := TraceTx("update", "main")
+	uErr := db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{"main", "data"} {
+			if _, err := tx.CreateBucketIfNotExists(Bucket(name)); err != nil {
+				return fmt.Errorf("create '%s' bucket failed:\n%s", name, err)
+			}
+		}
+		return nil
+	})
+	t.Done(uErr)
+	if uErr != nil {
+		return 0, nil, fmt.Errorf("update transaction failed:\n%s", uErr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pending = make(map[int]string)
+	for r := range fetchOrdered(ctx, from, to, FetchWorkers) {
+		var netErr *NetworkError
+		switch {
+		case errors.As(r.Err, &netErr): // queue for retry on the next update
+			fmt.Printf("file failed: %v (%v)\n", r.Num, r.Err)
+			pending[r.Num] = r.Err.Error()
+			noteFailure(r.Num, "fetch", r.Err)
+		case r.Err != nil:
+			noteFailure(r.Num, "fetch", r.Err)
+			return n, pending, fmt.Errorf("request failed: %w\n comics indexed: %v", r.Err, n)
+		case !r.OK: // missing below the latest number
+		default:
+			if _, _, err := replaceComic(db, r.Num, r.Info); err != nil {
+				noteFailure(r.Num, "fetch", err)
+				return n, pending, fmt.Errorf("index %v failed: %w", r.Num, err)
+			}
+			fmt.Printf("file processed: %v\n", r.Num)
+			n++
+		}
+	}
+	return n, pending, nil
+}
@@ -0,0 +1,138 @@
+package xkcd
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/boltdb/bolt"
+)
+
+// archiveLink matches a comic's link in the archive page
+// (ex: <a href="/2000/" title="2018-5-30">xkcd Phone 2000</a>)
+var archiveLink = regexp.MustCompile(`<a href="/(\d+)/" title="(\d+)-(\d+)-(\d+)">([^<]*)</a>`)
+
+// archiveEntry is a comic as listed on the archive page
+type archiveEntry struct {
+	Title            string
+	Year, Month, Day int
+}
+
+// Discrepancy is a comic whose stored data disagrees with the archive
+type Discrepancy struct {
+	Num    int
+	Reason string
+}
+
+// Reconcile compares the titles and dates of the stored comics with
+// xkcd.com's archive listing and, unless dry is set, queues each comic
+// that differs or is missing for retry in the 'pending' bucket, so the
+// next update refetches it. Comics after the last update aren't checked.
+func Reconcile(dry bool) ([]Discrepancy, error) {
+	archive, err := readArchive()
+	if err != nil {
+		return nil, err
+	}
+	GetIndex()
+	db, err := OpenDB(IndexPath())
+	if err != nil {
+		return nil, fmt.Errorf("db failed to open:\n%s", err)
+	}
+
+	var found []Discrepancy
+	t := TraceTx("view", "data")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(Bucket("data"))
+		if b == nil {
+			return fmt.Errorf("'data' bucket not found")
+		}
+		for num := 1; num < Index; num++ {
+			a, listed := archive[num]
+			if !listed {
+				continue
+			}
+			t.Get()
+			v := b.Get(Itob(num))
+			if v == nil {
+				found = append(found, Discrepancy{num, "missing from index"})
+				continue
+			}
+			d, err := decodeLogData(v)
+			if err != nil {
+				return err
+			}
+			if reason := compareArchive(d, a); reason != "" {
+				found = append(found, Discrepancy{num, reason})
+			}
+		}
+		return nil
+	})
+	t.Done(vErr)
+	db.Close()
+	if vErr != nil {
+		return nil, fmt.Errorf("view op failed: %s", vErr)
+	}
+
+	if dry || len(found) == 0 {
+		return found, nil
+	}
+	queue := make(map[int]string)
+	for _, d := range found {
+		queue[d.Num] = "reconcile: " + d.Reason
+	}
+	if err := storePending(queue); err != nil {
+		return found, fmt.Errorf("storePending failed: %v", err)
+	}
+	return found, nil
+}
+
+// compareArchive describes how stored comic d differs from archive entry
+// a, or returns "" if they agree
+func compareArchive(d LogData, a archiveEntry) string {
+	var diffs []string
+	if strings.TrimSpace(d.Title) != a.Title {
+		diffs = append(diffs, fmt.Sprintf("title %q, archive %q", d.Title, a.Title))
+	}
+	y, _ := strconv.Atoi(d.Year)
+	m, _ := strconv.Atoi(d.Month)
+	day, _ := strconv.Atoi(d.Day)
+	if y != a.Year || m != a.Month || day != a.Day {
+		diffs = append(diffs, fmt.Sprintf("date %s-%s-%s, archive %d-%d-%d", d.Year, d.Month, d.Day, a.Year, a.Month, a.Day))
+	}
+	return strings.Join(diffs, "; ")
+}
+
+// readArchive downloads and parses xkcd.com's archive page
+func readArchive() (map[int]archiveEntry, error) {
+	url := XKCDURL + "archive/"
+	resp, err := httpGet(context.Background(), url)
+	if err != nil {
+		return nil, &NetworkError{URL: url, Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &NetworkError{URL: url, Status: resp.StatusCode, Err: fmt.Errorf("%s", resp.Status)}
+	}
+	page, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &NetworkError{URL: url, Err: err}
+	}
+
+	archive := make(map[int]archiveEntry)
+	for _, m := range archiveLink.FindAllSubmatch(page, -1) {
+		num, _ := strconv.Atoi(string(m[1]))
+		y, _ := strconv.Atoi(string(m[2]))
+		mo, _ := strconv.Atoi(string(m[3]))
+		d, _ := strconv.Atoi(string(m[4]))
+		archive[num] = archiveEntry{strings.TrimSpace(html.UnescapeString(string(m[5]))), y, mo, d}
+	}
+	if len(archive) == 0 {
+		return nil, fmt.Errorf("no comics found in %s", url)
+	}
+	return archive, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// reconcileIndex compares the stored titles and dates with xkcd.com's
+// archive listing and queues the comics that differ for refetch on the
+// next update ('xkcd reconcile -dry')
+func reconcileIndex(args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	dry := fs.Bool("dry", false, "report discrepancies without queueing them for refetch")
+	fs.Parse(args)
+
+	if err := checkIndex(); err != nil {
+		return err
+	}
+	closeIndex() // xkcd.Reconcile opens the database itself
+	return runReconcile(*dry)
+}
+
+// runReconcile runs a reconciliation and prints its discrepancies
+func runReconcile(dry bool) error {
+	found, err := xkcd.Reconcile(dry)
+	if err != nil {
+		return fmt.Errorf("reconcile failed: %w", err)
+	}
+	for _, d := range found {
+		fmt.Printf("%v\t%s\n", d.Num, d.Reason)
+	}
+	switch {
+	case len(found) == 0:
+		fmt.Println("index agrees with the archive")
+	case dry:
+		fmt.Printf("discrepancies: %v\n", len(found))
+	default:
+		fmt.Printf("discrepancies queued for refetch: %v\n", len(found))
+	}
+	return nil
+}
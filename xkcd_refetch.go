@@ -0,0 +1,238 @@
+package xkcd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Refetch re-downloads each comic in nums, replaces its LogData in the
+// 'data' bucket, and reconciles the posting lists of terms that were
+// added to or removed from the comic (ex: after upstream corrections).
+func Refetch(nums []int) error {
+	defer flushFailures() // after the database is closed
+	db, err := OpenDB(IndexPath())
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+	defer db.Close()
+
+	for _, num := range nums {
+		if num == 404 { // skip special case - http 404 error page
+			continue
+		}
+		if err := refetchComic(db, num); err != nil {
+			noteFailure(num, "refetch", err)
+			return fmt.Errorf("refetch %v failed: %w", num, err)
+		}
+	}
+	return nil
+}
+
+// refetchComic replaces the stored data and index entries for a single
+// comic, or adds them if the comic isn't indexed yet. Stored comics are
+// requested conditionally on the validator recorded when they were last
+// refetched, and left alone if xkcd.com reports them unchanged.
+func refetchComic(db *bolt.DB, num int) error {
+	var cond validator
+	if !ScrapeTranscripts { // stored info may lack a scraped transcript
+		t := TraceTx("view", "validators")
+		vErr := db.View(func(tx *bolt.Tx) error {
+			cond = storedValidator(tx, num)
+			t.Get()
+			return nil
+		})
+		t.Done(vErr)
+	}
+	respInfo, v, ok, err := fetchInfoIf(context.Background(), num, cond)
+	if errors.Is(err, errNotModified) {
+		fmt.Printf("file unchanged: %v\n", num)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("comic not found")
+	}
+	added, removed, err := replaceComic(db, num, respInfo)
+	if err != nil {
+		return err
+	}
+
+	t := TraceTx("update", "validators")
+	uErr := db.Update(func(tx *bolt.Tx) error {
+		return putValidator(tx, num, v, t)
+	})
+	t.Done(uErr)
+	if uErr != nil {
+		return fmt.Errorf("update transaction failed:\n%s", uErr)
+	}
+	fmt.Printf("file refetched: %v (terms added: %v, removed: %v)\n", num, added, removed)
+	return nil
+}
+
+// replaceComic stores comic num's JSON info respInfo, replacing its data
+// and reconciling its postings if it is already indexed, and returns the
+// number of terms it was added to and removed from
+func replaceComic(db *bolt.DB, num int, respInfo []byte) (added, removed int, err error) {
+	var d LogData
+	if err := json.Unmarshal(respInfo, &d); err != nil {
+		return 0, 0, fmt.Errorf("JSON unmarshalling failed: %s", err)
+	}
+	if d.Link == "" { // 'Link' field is usually empty in json http response
+		d.Link = XKCDURL + strconv.Itoa(num)
+	}
+	newTerms := termSet(formatEntry(respInfo))
+
+	t := TraceTx("update", "main")
+	uErr := db.Update(func(tx *bolt.Tx) error {
+		if err := InvalidateCache(tx); err != nil {
+			return err
+		}
+		if err := recordTokenRules(tx, t); err != nil {
+			return err
+		}
+		data, main := tx.Bucket(Bucket("data")), tx.Bucket(Bucket("main"))
+		if data == nil || main == nil {
+			return fmt.Errorf("index not found - run with -u first")
+		}
+		pb := data.Get(Itob(num))
+		t.Get()
+		stored := pb != nil
+		var old LogData
+		oldTerms := make(map[string]bool)
+		if stored {
+			var err error
+			if old, err = decodeLogData(pb); err != nil {
+				return err
+			}
+			oldTerms = termSet(formatMapData(mapDataOf(old)))
+		}
+
+		// remove DocID from terms no longer in comic, add to new terms
+		for term := range oldTerms {
+			if newTerms[term] {
+				continue
+			}
+			refs := removeRef(Bstois(main.Get([]byte(term))), num)
+			var err error
+			if len(refs) == 0 {
+				err = main.Delete([]byte(term))
+				t.Delete()
+			} else {
+				err = main.Put([]byte(term), Istobs(refs))
+				t.Put([]byte(term), Istobs(refs))
+			}
+			if err != nil {
+				return fmt.Errorf("put failed:\n%s", err)
+			}
+			removed++
+		}
+		for term := range newTerms {
+			if oldTerms[term] {
+				continue
+			}
+			refs := insertRef(Bstois(main.Get([]byte(term))), num)
+			if err := main.Put([]byte(term), Istobs(refs)); err != nil {
+				return fmt.Errorf("put failed:\n%s", err)
+			}
+			t.Put([]byte(term), Istobs(refs))
+			added++
+		}
+
+		delta := NewDoc(d).Len() - docLen(pb)
+		pb = convToProto(d)
+		if err := data.Put(Itob(num), pb); err != nil {
+			return fmt.Errorf("put failed:\n%s", err)
+		}
+		t.Put(Itob(num), pb)
+		if err := addTotalTerms(tx, delta, t); err != nil {
+			return err
+		}
+		if err := putFetched(tx, num, time.Now(), t); err != nil {
+			return err
+		}
+
+		if stored && old.Title == d.Title {
+			return nil
+		}
+		tb, err := titleBucket(tx, t)
+		if err != nil {
+			return err
+		}
+		if err := deleteTitle(tb, old.Title, num, t); err != nil {
+			return err
+		}
+		return putTitle(tb, d.Title, num, t)
+	})
+	t.Done(uErr)
+	if uErr != nil {
+		return 0, 0, fmt.Errorf("update transaction failed:\n%s", uErr)
+	}
+	if err := appendLog(respInfo); err != nil {
+		return added, removed, fmt.Errorf("Write to %s failed:\n%v", LogFile(), err)
+	}
+	comicsIndexed(map[int]LogData{num: d})
+	return added, removed, nil
+}
+
+// mapDataOf returns the indexed fields of stored LogData as MapData
+func mapDataOf(d LogData) *MapData {
+	link := d.Link
+	if link == XKCDURL+strconv.Itoa(int(d.Num)) {
+		link = "" // set by the indexer
+	}
+	return &MapData{
+		Num:        int(d.Num),
+		Link:       link,
+		Year:       d.Year,
+		News:       d.News,
+		SafeTitle:  d.SafeTitle,
+		Transcript: d.Transcript,
+		Alt:        d.Alt,
+		Title:      d.Title,
+	}
+}
+
+// termSet returns the unique terms in formatted data
+func termSet(data []byte) map[string]bool {
+	terms := make(map[string]bool)
+	s := bufio.NewScanner(bytes.NewReader(data))
+	s.Split(bufio.ScanWords)
+	for s.Scan() {
+		terms[s.Text()] = true
+	}
+	return terms
+}
+
+// insertRef adds DocID i to the sorted posting list s if not present
+func insertRef(s []int, i int) []int {
+	j := sort.SearchInts(s, i)
+	if j < len(s) && s[j] == i {
+		return s
+	}
+	s = append(s, 0)
+	copy(s[j+1:], s[j:])
+	s[j] = i
+	return s
+}
+
+// removeRef removes every occurrence of DocID i from posting list s
+func removeRef(s []int, i int) []int {
+	var r []int
+	for _, v := range s {
+		if v != i {
+			r = append(r, v)
+		}
+	}
+	return r
+}
@@ -0,0 +1,127 @@
+package xkcd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+// ClusterPrefix prefixes the terms the cluster command stores
+// (ex: 'cluster:3'); they aren't derived from the comics' text, so they
+// survive a reindex
+const ClusterPrefix = "cluster:"
+
+// Reindex rebuilds the 'main' and 'title' buckets from the records in the
+// 'data' and 'translations' buckets with the tokenization rules in use,
+// and records the rules in the index, so changes to the rules can be
+// applied without downloading the comics again. It returns the number of
+// comics and terms indexed.
+func Reindex() (comics, terms int, err error) {
+	db, err := OpenDB(IndexPath())
+	if err != nil {
+		return 0, 0, fmt.Errorf("db failed to open:\n%s", err)
+	}
+	defer db.Close()
+
+	t := TraceTx("update", "main")
+	uErr := db.Update(func(tx *bolt.Tx) error {
+		data := tx.Bucket(Bucket("data"))
+		if data == nil {
+			return fmt.Errorf("index not found - run with -u first")
+		}
+		if err := InvalidateCache(tx); err != nil {
+			return err
+		}
+
+		// DocIDs are visited in ascending order, so appended lists stay sorted
+		index := make(map[string][]int)
+		total := 0
+		err := data.ForEach(func(k, v []byte) error {
+			d, err := decodeLogData(v)
+			if err != nil {
+				return err
+			}
+			t.Get()
+			i := Btoi(k)
+			for term := range termSet(formatMapData(mapDataOf(d))) {
+				index[term] = append(index[term], i)
+			}
+			total += NewDoc(d).Len()
+			comics++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if tb := tx.Bucket(Bucket("translations")); tb != nil {
+			err := tb.ForEach(func(k, v []byte) error {
+				var tl Translation
+				if err := json.Unmarshal(v, &tl); err != nil {
+					return fmt.Errorf("JSON unmarshalling failed: %s", err)
+				}
+				t.Get()
+				i := Btoi(k[:2])
+				for term := range termSet(formatText(tl.Title + " " + tl.Alt)) {
+					index[term] = insertRef(index[term], i)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		clusters := make(map[string][]byte)
+		if main := tx.Bucket(Bucket("main")); main != nil {
+			c := main.Cursor()
+			prefix := []byte(ClusterPrefix)
+			for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+				clusters[string(k)] = append([]byte(nil), v...)
+			}
+			if err := tx.DeleteBucket(Bucket("main")); err != nil {
+				return fmt.Errorf("delete 'main' bucket failed:\n%s", err)
+			}
+		}
+		main, err := tx.CreateBucket(Bucket("main"))
+		if err != nil {
+			return fmt.Errorf("create 'main' bucket failed:\n%s", err)
+		}
+		for term, refs := range index {
+			if err := main.Put([]byte(term), Istobs(refs)); err != nil {
+				return fmt.Errorf("put failed:\n%s", err)
+			}
+			t.Put([]byte(term), Istobs(refs))
+		}
+		for k, v := range clusters {
+			if err := main.Put([]byte(k), v); err != nil {
+				return fmt.Errorf("put failed:\n%s", err)
+			}
+			t.Put([]byte(k), v)
+		}
+		terms = len(index)
+
+		// titleBucket rebuilds a missing 'title' bucket from 'data'
+		if tx.Bucket(Bucket("title")) != nil {
+			if err := tx.DeleteBucket(Bucket("title")); err != nil {
+				return fmt.Errorf("delete 'title' bucket failed:\n%s", err)
+			}
+		}
+		if _, err := titleBucket(tx, t); err != nil {
+			return err
+		}
+		if err := putTotalTerms(tx, total, t); err != nil {
+			return err
+		}
+		return putTokenRules(tx, t)
+	})
+	t.Done(uErr)
+	if uErr != nil {
+		return 0, 0, fmt.Errorf("update transaction failed:\n%s", uErr)
+	}
+	if err := RefreshShards(); err != nil {
+		return comics, terms, err
+	}
+	return comics, terms, nil
+}
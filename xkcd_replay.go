@@ -0,0 +1,46 @@
+package xkcd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// ReplayDir is a directory of previously captured JSON responses. When set,
+// GetInfo reads comics from '<ReplayDir>/<num>.json' instead of xkcd.com,
+// allowing indexing changes to be benchmarked against a fixed corpus.
+var ReplayDir string
+
+// RecordDir is a directory each downloaded JSON response is captured to
+// as '<num>.json' for later use with 'ReplayDir'.
+var RecordDir string
+
+// replayInfo reads the captured JSON response for comic i from 'ReplayDir'.
+// A missing file marks the end of the captured corpus.
+func replayInfo(i int) ([]byte, bool, error) {
+	respInfo, err := readFile(capturePath(ReplayDir, i))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("replay read failed: %v", err)
+	}
+	return respInfo, true, nil
+}
+
+// recordInfo captures the JSON response for comic i to 'RecordDir'
+func recordInfo(i int, respInfo []byte) error {
+	if err := Files.MkdirAll(RecordDir, 0766); err != nil {
+		return fmt.Errorf("create record dir failed: %v", err)
+	}
+	if err := writeFile(capturePath(RecordDir, i), respInfo, 0666); err != nil {
+		return fmt.Errorf("record write failed: %v", err)
+	}
+	return nil
+}
+
+// capturePath returns the path of the captured response for comic i in dir
+func capturePath(dir string, i int) string {
+	return filepath.Join(dir, strconv.Itoa(i)+".json")
+}
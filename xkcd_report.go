@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/boltdb/bolt"
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// corpusStats summarizes the stored comics and inverted index
+type corpusStats struct {
+	Comics           int         `json:"comics"`
+	Vocabulary       int         `json:"vocabulary"`
+	AvgTranscriptLen float64     `json:"avg_transcript_len"`
+	Years            []yearStats `json:"years"`
+}
+
+// yearStats are the statistics for a single publication year
+type yearStats struct {
+	Year       string `json:"year"`
+	Comics     int    `json:"comics"`
+	NewTerms   int    `json:"new_terms"`  // terms first seen this year
+	Vocabulary int    `json:"vocabulary"` // cumulative unique terms
+}
+
+// corpusReport prints corpus statistics as a table or JSON ('xkcd report -json')
+func corpusReport(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "write report as JSON")
+	fs.Parse(args)
+
+	if err := checkIndex(); err != nil {
+		return err
+	}
+	db, err := openIndex(false)
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+
+	stats, err := corpusStatistics(db)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	}
+	fmt.Printf("comics: %v\n", stats.Comics)
+	fmt.Printf("vocabulary size: %v\n", stats.Vocabulary)
+	fmt.Printf("average transcript length: %.1f chars\n\n", stats.AvgTranscriptLen)
+	fmt.Printf("%-6s\t%8s\t%9s\t%10s\n", "year", "comics", "new terms", "vocabulary")
+	for _, y := range stats.Years {
+		fmt.Printf("%-6s\t%8d\t%9d\t%10d\n", y.Year, y.Comics, y.NewTerms, y.Vocabulary)
+	}
+	return nil
+}
+
+// corpusStatistics computes corpus statistics from the data index,
+// tracking vocabulary growth in order of publication
+func corpusStatistics(db *bolt.DB) (corpusStats, error) {
+	var stats corpusStats
+	var transcriptLen int
+	years := make(map[string]*yearStats)
+	seen := make(map[string]bool)
+	err := eachComic(db, func(d xkcd.LogData) {
+		stats.Comics++
+		transcriptLen += len(d.Transcript)
+		y, ok := years[d.Year]
+		if !ok {
+			y = &yearStats{Year: d.Year}
+			years[d.Year] = y
+		}
+		y.Comics++
+		for _, term := range xkcd.DocTerms(d) {
+			if !seen[term] {
+				seen[term] = true
+				y.NewTerms++
+			}
+		}
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	t := xkcd.TraceTx("view", "main")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(xkcd.Bucket("main")); b != nil {
+			stats.Vocabulary = b.Stats().KeyN
+		}
+		return nil
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		return stats, fmt.Errorf("view op failed: %w", vErr)
+	}
+
+	if stats.Comics > 0 {
+		stats.AvgTranscriptLen = float64(transcriptLen) / float64(stats.Comics)
+	}
+	for _, y := range years {
+		stats.Years = append(stats.Years, *y)
+	}
+	sort.Slice(stats.Years, func(i, j int) bool {
+		return stats.Years[i].Year < stats.Years[j].Year
+	})
+	vocab := 0
+	for i := range stats.Years {
+		vocab += stats.Years[i].NewTerms
+		stats.Years[i].Vocabulary = vocab
+	}
+	return stats, nil
+}
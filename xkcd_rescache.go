@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// cacheKey returns the key a query's DocIDs are cached under: the search
+// mode followed by the query normalized so that repeated or reordered
+// queries share an entry (ex: 'all:bobby tables', 'msm=-1:a b c')
+func cacheKey(query []string, text string) string {
+	if titleSearch {
+		return "title:" + xkcd.NormalizeTitle(text)
+	}
+	seen := make(map[string]bool)
+	var terms []string
+	for _, t := range query {
+		if !seen[t] {
+			seen[t] = true
+			terms = append(terms, t)
+		}
+	}
+	sort.Strings(terms)
+	mode := "all"
+	if minShouldMatch != "" {
+		mode = "msm=" + minShouldMatch
+	}
+	if activePeriod != nil { // period searches may read only the year shards
+		mode += "@" + activePeriod.From + ":" + activePeriod.To
+	}
+	return mode + ":" + strings.Join(terms, " ")
+}
+
+// cachedRefs returns the DocIDs cached for key in the 'cache' bucket.
+// The bucket is deleted whenever the index changes.
+func cachedRefs(key string) ([]int, bool) {
+	db, err := openIndex(false)
+	if err != nil {
+		return nil, false
+	}
+
+	var refs []int
+	var ok bool
+	t := xkcd.TraceTx("view", "cache")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(xkcd.Bucket("cache"))
+		if b == nil {
+			return nil
+		}
+		v := b.Get([]byte(key))
+		t.Get()
+		if v == nil {
+			return nil
+		}
+		ok = true
+		return json.Unmarshal(v, &refs)
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		return nil, false
+	}
+	return refs, ok
+}
+
+// cacheRefs stores the DocIDs for key in the 'cache' bucket. Nothing is
+// stored when the database is opened with -readonly.
+func cacheRefs(key string, refs []int) error {
+	if xkcd.DBOptions.ReadOnly {
+		return nil
+	}
+	if refs == nil {
+		refs = []int{}
+	}
+	v, err := json.Marshal(refs)
+	if err != nil {
+		return fmt.Errorf("JSON marshalling failed: %s", err)
+	}
+	db, err := openIndex(true)
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+	defer releaseWrite()
+
+	t := xkcd.TraceTx("update", "cache")
+	uErr := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(xkcd.Bucket("cache"))
+		if err != nil {
+			return fmt.Errorf("create 'cache' bucket failed:\n%s", err)
+		}
+		t.Put([]byte(key), v)
+		return b.Put([]byte(key), v)
+	})
+	t.Done(uErr)
+	if uErr != nil {
+		return fmt.Errorf("update transaction failed:\n%w", uErr)
+	}
+	return nil
+}
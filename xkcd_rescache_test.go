@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+func TestCacheRefsReadOnly(t *testing.T) {
+	dataDir, options := xkcd.DataDir, xkcd.DBOptions
+	defer func() { xkcd.DataDir, xkcd.DBOptions = dataDir, options }()
+	xkcd.DataDir = t.TempDir()
+	xkcd.DBOptions.ReadOnly = true
+	defer closeIndex()
+
+	if err := cacheRefs("and:bitcoin", []int{1, 2}); err != nil {
+		t.Errorf("cacheRefs with -readonly = %v, want nil", err)
+	}
+	if indexDB != nil {
+		t.Error("cacheRefs with -readonly opened the database")
+	}
+}
+
+func TestRecordAbsentReadOnly(t *testing.T) {
+	dataDir, options := xkcd.DataDir, xkcd.DBOptions
+	defer func() { xkcd.DataDir, xkcd.DBOptions = dataDir, options }()
+	xkcd.DataDir = t.TempDir()
+	xkcd.DBOptions.ReadOnly = true
+	defer closeIndex()
+
+	if err := recordAbsent([]string{"qwzx"}); err != nil {
+		t.Errorf("recordAbsent with -readonly = %v, want nil", err)
+	}
+	if indexDB != nil {
+		t.Error("recordAbsent with -readonly opened the database")
+	}
+}
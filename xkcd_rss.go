@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// rss is an RSS 2.0 document
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate,omitempty"`
+}
+
+// writeRSS writes the results of query text as an RSS feed with an item
+// per comic, using its alt text as the description ('-format rss')
+func writeRSS(w io.Writer, text string, results []Result) error {
+	query := strings.Join(strings.Fields(text), " ")
+	feed := rss{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       "xkcd search: " + query,
+			Link:        xkcd.XKCDURL,
+			Description: fmt.Sprintf("xkcd comics matching '%s'", query),
+		},
+	}
+	for _, r := range results {
+		d := r.Data
+		link := xkcd.XKCDURL + strconv.Itoa(int(d.Num)) + "/"
+		item := rssItem{Title: d.Title, Link: link, Description: d.Alt, GUID: link}
+		if t, err := time.Parse("2006-01-02", comicDate(d)); err == nil {
+			item.PubDate = t.Format(time.RFC1123Z)
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return fmt.Errorf("XML encoding failed: %s", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/boltdb/bolt"
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// listRuns prints the stored summaries of the most recent updates
+// ('xkcd runs -n 5 -json')
+func listRuns(args []string) error {
+	fs := flag.NewFlagSet("runs", flag.ExitOnError)
+	n := fs.Int("n", 1, "number of most recent updates to show")
+	asJSON := fs.Bool("json", false, "write summaries as JSON")
+	fs.Parse(args)
+
+	if err := checkIndex(); err != nil {
+		return err
+	}
+	db, err := openIndex(false)
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+	var runs []xkcd.RunSummary
+	t := xkcd.TraceTx("view", "runs")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		var err error
+		runs, err = xkcd.Runs(tx)
+		t.Get()
+		return err
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		return fmt.Errorf("view op failed: %w", vErr)
+	}
+	if len(runs) == 0 {
+		fmt.Println("no updates recorded")
+		return errNoResults
+	}
+	if *n > 0 && *n < len(runs) {
+		runs = runs[:*n]
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(runs)
+	}
+	for _, r := range runs {
+		fmt.Printf("\nupdate started %v", r.Started.Format("2006-01-02 15:04:05"))
+		r.Print()
+	}
+	return nil
+}
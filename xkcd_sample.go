@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// sampleData prints n random comics from the data index and optionally
+// compares them to the live data on xkcd.com ('xkcd sample -n 20 -live')
+func sampleData(args []string) error {
+	fs := flag.NewFlagSet("sample", flag.ExitOnError)
+	n := fs.Int("n", 10, "number of comics to sample")
+	live := fs.Bool("live", false, "re-fetch each comic from xkcd.com for comparison")
+	fs.Parse(args)
+	if *live {
+		if err := requireNetwork("sample -live"); err != nil {
+			return err
+		}
+	}
+
+	if err := checkIndex(); err != nil {
+		return err
+	}
+	db, err := openIndex(false)
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+
+	// pick n DocIDs from the 'data' bucket at random
+	var sample []xkcd.LogData
+	t := xkcd.TraceTx("view", "data")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(xkcd.Bucket("data"))
+		if b == nil {
+			return indexErrorf("data index not found - run with -u first")
+		}
+		var keys [][]byte
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			keys = append(keys, k)
+		}
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+		for _, i := range r.Perm(len(keys)) {
+			if len(sample) == *n {
+				break
+			}
+			d := decodeProto(b.Get(keys[i]))
+			t.Get()
+			if activePeriod.contains(d) {
+				sample = append(sample, d)
+			}
+		}
+		return nil
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		return fmt.Errorf("view op failed: %w", vErr)
+	}
+
+	for _, d := range sample {
+		fmt.Printf("Num: %d\nDate: %s-%s-%s\nTitle: %s\nAlt: %s\nLink: %s\n",
+			d.Num, d.Year, d.Month, d.Day, d.Title, d.Alt, d.Link)
+		if *live {
+			compareLive(d)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("sampled %v comics\n", len(sample))
+	return nil
+}
+
+// compareLive prints each field of the stored comic d that differs from
+// the data currently served by xkcd.com
+func compareLive(d xkcd.LogData) {
+	l, err := xkcd.GetComic(int(d.Num))
+	if err != nil {
+		fmt.Printf("live: %v\n", err)
+		return
+	}
+	c := xkcd.NewComic(d)
+	fields := []struct {
+		name         string
+		stored, live string
+	}{
+		{"Title", c.Title, l.Title},
+		{"SafeTitle", c.SafeTitle, l.SafeTitle},
+		{"Date", c.PublishedAt.Format("2006-01-02"), l.PublishedAt.Format("2006-01-02")},
+		{"Alt", c.Alt, l.Alt},
+		{"Img", urlString(c.Image), urlString(l.Image)},
+		{"News", c.News, l.News},
+		{"Transcript", c.Transcript, l.Transcript},
+	}
+	diffs := 0
+	for _, f := range fields {
+		if f.stored != f.live {
+			fmt.Printf("live: %s differs\n\tstored: %q\n\tlive:   %q\n", f.name, f.stored, f.live)
+			diffs++
+		}
+	}
+	if diffs == 0 {
+		fmt.Println("live: matches stored data")
+	}
+}
+
+// urlString returns u as a string, or "" if u is nil
+func urlString(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	return u.String()
+}
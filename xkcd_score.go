@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// rankResults orders search results by score instead of DocID
+var rankResults bool
+
+// explainResults prints how each search result's score was computed
+var explainResults bool
+
+// recentWeight scales the boost given to newer comics (0 disables the boost)
+var recentWeight float64
+
+// scorer replaces the weighted tf-idf sum of each result's score when
+// set, and scorerName is the name it was selected by
+var (
+	scorer     xkcd.Scorer
+	scorerName string
+)
+
+// fieldNames are the indexed fields of a comic, in order of display
+var fieldNames = []string{"title", "alt", "transcript", "year", "num"}
+
+// fieldWeights scale the term frequency of matches in each field, so
+// matches in short fields like titles outrank incidental transcript mentions
+var fieldWeights = map[string]float64{
+	"title":      3,
+	"alt":        2,
+	"transcript": 1,
+	"year":       1,
+	"num":        1,
+}
+
+// parseWeights overrides 'fieldWeights' from a list of field=weight pairs
+// (ex: 'title=5,alt=2')
+func parseWeights(s string) error {
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid field weight %q: expected field=weight", pair)
+		}
+		if _, ok := fieldWeights[kv[0]]; !ok {
+			return fmt.Errorf("invalid field weight %q: unknown field", pair)
+		}
+		w, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil || w < 0 {
+			return fmt.Errorf("invalid field weight %q: bad weight", pair)
+		}
+		fieldWeights[kv[0]] = w
+	}
+	return nil
+}
+
+// termMatch records how often a query term occurs in each field of a result
+type termMatch struct {
+	Term   string
+	DF     int // documents containing term
+	IDF    float64
+	Fields map[string]int // field: term frequency
+}
+
+// Result is a search result with its score
+type Result struct {
+	Data    xkcd.LogData
+	Score   float64
+	Matched int // query terms whose posting lists contain the result
+	Matches []termMatch
+	Window  int     // shortest transcript span containing the matched terms
+	Boost   float64 // proximity boost applied to the score
+	Recency float64 // recency boost applied to the score
+	Source  string  // namespace the result was found in
+}
+
+// scoreResults scores each result as the sum of tf * weight * idf for
+// every query term and field, where tf counts occurrences in the field,
+// weight is the field's weight and idf = log(N / df) for N comics in the
+// index, multiplied by a boost for query terms close together in the
+// transcript and, if enabled, a boost for newer comics. With 'scorer'
+// set, the sum is replaced by the scorer's score.
+func scoreResults(query []string, data []xkcd.LogData, resultMap map[string][]int) []Result {
+	n := countDocs()
+	newest := 0
+	if recentWeight > 0 {
+		newest = newestDoc()
+	}
+	var stats xkcd.Stats
+	if scorer != nil && len(data) > 0 {
+		stats = xkcd.Stats{Docs: n, DF: make(map[string]int), AvgLen: avgDocLen()}
+		for term, refs := range resultMap {
+			stats.DF[term] = len(refs)
+		}
+	}
+	results := make([]Result, len(data))
+	for i, d := range data {
+		r := Result{Data: d, Matched: matchedTerms(resultMap, int(d.Num))}
+		seen := make(map[string]bool)
+		for _, term := range query {
+			if seen[term] {
+				continue
+			}
+			seen[term] = true
+			m := termMatch{Term: term, DF: len(resultMap[term]), Fields: fieldFreqsOf(d, term)}
+			if m.DF > 0 && n > 0 {
+				m.IDF = math.Log(float64(n) / float64(m.DF))
+			}
+			for f, tf := range m.Fields {
+				r.Score += float64(tf) * fieldWeights[f] * m.IDF
+			}
+			r.Matches = append(r.Matches, m)
+		}
+		if scorer != nil {
+			r.Score = scorer.Score(query, xkcd.NewDoc(d), stats)
+		}
+		matched, window := proximity(d, query)
+		r.Window, r.Boost = window, proximityBoost(matched, window)
+		r.Score *= r.Boost
+		r.Recency = recencyBoost(int(d.Num), newest)
+		r.Score *= r.Recency
+		results[i] = r
+	}
+	return results
+}
+
+// fieldFreqsOf counts the occurrences of term in each indexed field of d
+func fieldFreqsOf(d xkcd.LogData, term string) map[string]int {
+	freqs := make(map[string]int)
+	for _, f := range fieldNames {
+		s, _ := fieldText(d, f)
+		for _, t := range xkcd.Tokenize(s) {
+			if t == term {
+				freqs[f]++
+			}
+		}
+	}
+	return freqs
+}
+
+// termFreqsOf counts the occurrences of every term in the indexed fields of d
+func termFreqsOf(d xkcd.LogData) map[string]int {
+	tf := make(map[string]int)
+	for _, f := range fieldNames {
+		s, _ := fieldText(d, f)
+		for _, t := range xkcd.Tokenize(s) {
+			tf[t]++
+		}
+	}
+	return tf
+}
+
+// sortByNum orders unranked results by comic number, keeping the order
+// of -source namespaces for the same comic
+func sortByNum(results []Result) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Data.Num < results[j].Data.Num
+	})
+}
+
+// sortByScore orders results by descending score, then by comic number
+func sortByScore(results []Result) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Data.Num < results[j].Data.Num
+	})
+}
+
+// explain prints the matched terms, fields and frequencies behind a result's score
+func explain(r Result) {
+	fmt.Printf("Score: %.3f (%d terms matched)\n", r.Score, r.Matched)
+	if scorer != nil {
+		fmt.Printf("  scorer: %s\n", scorerName)
+	}
+	for _, m := range r.Matches {
+		fmt.Printf("  '%s' df=%d idf=%.3f:", m.Term, m.DF, m.IDF)
+		for _, f := range fieldNames {
+			if tf := m.Fields[f]; tf > 0 {
+				fmt.Printf(" %s=%dx%g", f, tf, fieldWeights[f])
+			}
+		}
+		fmt.Println()
+	}
+	if r.Window > 0 {
+		fmt.Printf("  proximity: terms within %d words of transcript, boost x%.3f\n", r.Window, r.Boost)
+	}
+	if recentWeight > 0 {
+		fmt.Printf("  recency: boost x%.3f\n", r.Recency)
+	}
+}
+
+// recencyBoost returns the factor a comic's score is multiplied by:
+// 1 + weight * num / newest, so the newest comic's score is doubled at
+// a weight of 1 and the oldest is barely changed
+func recencyBoost(num, newest int) float64 {
+	if recentWeight <= 0 || newest == 0 {
+		return 1
+	}
+	return 1 + recentWeight*float64(num)/float64(newest)
+}
+
+// newestDoc returns the highest DocID in the data index
+func newestDoc() int {
+	var newest int
+	db, oErr := openIndex(false)
+	if oErr != nil {
+		fmt.Printf("db failed to open:\n%s", oErr)
+		return 0
+	}
+
+	t := xkcd.TraceTx("view", "data")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(xkcd.Bucket("data")); b != nil {
+			if k, _ := b.Cursor().Last(); k != nil {
+				newest = xkcd.Btoi(k)
+			}
+			t.Get()
+		}
+		return nil
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		fmt.Printf("view op failed: %s\n", vErr)
+	}
+	return newest
+}
+
+// countDocs returns the number of comics in the data index
+func countDocs() int {
+	var n int
+	db, oErr := openIndex(false)
+	if oErr != nil {
+		fmt.Printf("db failed to open:\n%s", oErr)
+		return 0
+	}
+
+	t := xkcd.TraceTx("view", "data")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(xkcd.Bucket("data")); b != nil {
+			n = b.Stats().KeyN
+		}
+		return nil
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		fmt.Printf("view op failed: %s\n", vErr)
+	}
+	return n
+}
+
+// avgDocLen returns the average number of terms per comic in the data
+// index, for scorers that normalize by length. The total recorded in the
+// index is used; indexes that don't record it yet are counted.
+func avgDocLen() float64 {
+	db, oErr := openIndex(false)
+	if oErr != nil {
+		fmt.Printf("db failed to open:\n%s", oErr)
+		return 0
+	}
+
+	var docs, terms int
+	t := xkcd.TraceTx("view", "data")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(xkcd.Bucket("data"))
+		if b == nil {
+			return nil
+		}
+		if n, ok := xkcd.TotalTerms(tx); ok {
+			docs, terms = b.Stats().KeyN, n
+			return nil
+		}
+		return b.ForEach(func(_, v []byte) error {
+			t.Get()
+			docs++
+			terms += xkcd.NewDoc(decodeProto(v)).Len()
+			return nil
+		})
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		fmt.Printf("view op failed: %s\n", vErr)
+	}
+	if docs == 0 {
+		return 0
+	}
+	return float64(terms) / float64(docs)
+}
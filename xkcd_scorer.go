@@ -0,0 +1,162 @@
+package xkcd
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DocFields are the indexed fields of a comic a Doc holds the terms of
+var DocFields = []string{"title", "alt", "transcript", "year", "num"}
+
+// Doc is a comic being scored: the terms of each of its indexed fields
+type Doc struct {
+	Num    int
+	Fields map[string][]string // field (see DocFields): its terms in order
+}
+
+// NewDoc returns the Doc of the stored comic d, tokenized with the rules
+// in use
+func NewDoc(d LogData) Doc {
+	text := map[string]string{
+		"title":      d.Title,
+		"alt":        d.Alt,
+		"transcript": d.Transcript,
+		"year":       d.Year,
+		"num":        strconv.Itoa(int(d.Num)),
+	}
+	doc := Doc{Num: int(d.Num), Fields: make(map[string][]string)}
+	for _, f := range DocFields {
+		doc.Fields[f] = Tokenize(text[f])
+	}
+	return doc
+}
+
+// Len returns the number of terms in every field of the doc
+func (d Doc) Len() int {
+	n := 0
+	for _, terms := range d.Fields {
+		n += len(terms)
+	}
+	return n
+}
+
+// TF returns the number of times term occurs in every field of the doc
+func (d Doc) TF(term string) int {
+	n := 0
+	for _, terms := range d.Fields {
+		for _, t := range terms {
+			if t == term {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// Stats are the index statistics documents are scored with
+type Stats struct {
+	Docs   int            // comics in the index
+	DF     map[string]int // comics containing each query term
+	AvgLen float64        // average number of terms per comic
+}
+
+// Scorer scores a document for a query; higher scores rank first
+type Scorer interface {
+	Score(query []string, doc Doc, stats Stats) float64
+}
+
+// ScorerFunc adapts an ordinary function to a Scorer
+type ScorerFunc func(query []string, doc Doc, stats Stats) float64
+
+// Score calls f
+func (f ScorerFunc) Score(query []string, doc Doc, stats Stats) float64 {
+	return f(query, doc, stats)
+}
+
+// BM25 is the Okapi BM25 scorer: term frequency saturates at a rate set
+// by K1, and B sets how much longer comics are penalized
+type BM25 struct {
+	K1, B float64
+}
+
+// Score sums the BM25 weight of each unique query term in doc
+func (s BM25) Score(query []string, doc Doc, stats Stats) float64 {
+	var score float64
+	norm := 1.0
+	if stats.AvgLen > 0 {
+		norm = 1 - s.B + s.B*float64(doc.Len())/stats.AvgLen
+	}
+	for _, term := range uniqueTerms(query) {
+		tf := float64(doc.TF(term))
+		if tf == 0 {
+			continue
+		}
+		df := float64(stats.DF[term])
+		idf := math.Log(1 + (float64(stats.Docs)-df+0.5)/(df+0.5))
+		score += idf * tf * (s.K1 + 1) / (tf + s.K1*norm)
+	}
+	return score
+}
+
+// TermCount scores a doc by the number of occurrences of the query terms
+type TermCount struct{}
+
+// Score counts the occurrences of each unique query term in doc
+func (TermCount) Score(query []string, doc Doc, stats Stats) float64 {
+	var n int
+	for _, term := range uniqueTerms(query) {
+		n += doc.TF(term)
+	}
+	return float64(n)
+}
+
+// uniqueTerms returns the terms of query without repeats, in order
+func uniqueTerms(query []string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, t := range query {
+		if !seen[t] {
+			seen[t] = true
+			terms = append(terms, t)
+		}
+	}
+	return terms
+}
+
+var (
+	scorersMu sync.RWMutex
+	scorers   = map[string]Scorer{
+		"bm25":  BM25{K1: 1.2, B: 0.75},
+		"count": TermCount{},
+	}
+)
+
+// RegisterScorer makes s selectable by name at query time, replacing any
+// scorer registered under name
+func RegisterScorer(name string, s Scorer) {
+	scorersMu.Lock()
+	defer scorersMu.Unlock()
+	scorers[name] = s
+}
+
+// LookupScorer returns the scorer registered under name
+func LookupScorer(name string) (Scorer, bool) {
+	scorersMu.RLock()
+	defer scorersMu.RUnlock()
+	s, ok := scorers[name]
+	return s, ok
+}
+
+// ScorerNames returns the names of the registered scorers in order
+func ScorerNames() []string {
+	scorersMu.RLock()
+	defer scorersMu.RUnlock()
+	var names []string
+	for name := range scorers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
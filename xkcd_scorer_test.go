@@ -0,0 +1,37 @@
+package xkcd
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBM25Score(t *testing.T) {
+	s := BM25{K1: 1.2, B: 0.75}
+	doc := Doc{Num: 1, Fields: map[string][]string{
+		"title": {"bobby", "tables"},
+		"alt":   {"bobby", "drop"},
+	}}
+	stats := Stats{Docs: 10, DF: map[string]int{"bobby": 2, "tables": 1, "absent": 3}, AvgLen: 8}
+
+	// tf 2 for bobby, doc half the average length
+	norm := 1 - 0.75 + 0.75*4.0/8
+	idf := math.Log(1 + (10-2+0.5)/(2+0.5))
+	want := idf * 2 * 2.2 / (2 + 1.2*norm)
+	if got := s.Score([]string{"bobby", "bobby", "absent"}, doc, stats); math.Abs(got-want) > 1e-9 {
+		t.Errorf("Score(bobby bobby absent) = %v, want %v", got, want)
+	}
+
+	// rarer terms score higher at the same frequency
+	if s.Score([]string{"tables"}, doc, stats) <= s.Score([]string{"drop"}, doc, Stats{Docs: 10, DF: map[string]int{"drop": 5}, AvgLen: 8}) {
+		t.Error("rarer term didn't score higher")
+	}
+	if got := s.Score([]string{"absent"}, doc, stats); got != 0 {
+		t.Errorf("Score(absent) = %v, want 0", got)
+	}
+	// without an average length, length isn't normalized
+	noAvg := Stats{Docs: 10, DF: stats.DF}
+	want = idf * 2 * 2.2 / (2 + 1.2)
+	if got := s.Score([]string{"bobby"}, doc, noAvg); math.Abs(got-want) > 1e-9 {
+		t.Errorf("Score without AvgLen = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,78 @@
+package xkcd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ScrapeTranscripts fills in the transcript of comics whose JSON info has
+// none from the comic's page HTML
+var ScrapeTranscripts bool
+
+var (
+	transcriptDiv = regexp.MustCompile(`(?is)<div id="transcript"[^>]*>(.*?)</div>`)
+	comicImgTitle = regexp.MustCompile(`(?is)<div id="comic">.*?<img[^>]*\btitle="([^"]*)"`)
+	htmlTag       = regexp.MustCompile(`<[^>]*>`)
+)
+
+// scrapeFallback returns respInfo with its empty transcript replaced by
+// text scraped from comic i's page: div#transcript when present, or the
+// comic image's title attribute otherwise. respInfo is returned unchanged
+// if the transcript isn't empty or nothing could be scraped.
+func scrapeFallback(i int, respInfo []byte) []byte {
+	var info map[string]interface{}
+	if err := json.Unmarshal(respInfo, &info); err != nil {
+		return respInfo
+	}
+	if t, _ := info["transcript"].(string); strings.TrimSpace(t) != "" {
+		return respInfo
+	}
+	text, err := scrapeTranscript(i)
+	if err != nil {
+		fmt.Printf("transcript scrape failed: %v (%v)\n", i, err)
+		return respInfo
+	}
+	if text == "" {
+		return respInfo
+	}
+	info["transcript"] = text
+	b, err := json.Marshal(info)
+	if err != nil {
+		return respInfo
+	}
+	return b
+}
+
+// scrapeTranscript returns the transcript-like text of comic i's page
+func scrapeTranscript(i int) (string, error) {
+	url := XKCDURL + strconv.Itoa(i) + "/"
+	resp, err := httpGet(context.Background(), url)
+	if err != nil {
+		return "", &NetworkError{URL: url, Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", &NetworkError{URL: url, Status: resp.StatusCode, Err: fmt.Errorf("%s", resp.Status)}
+	}
+	page, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", &NetworkError{URL: url, Err: err}
+	}
+
+	m := transcriptDiv.FindSubmatch(page)
+	if m == nil {
+		m = comicImgTitle.FindSubmatch(page)
+	}
+	if m == nil {
+		return "", nil
+	}
+	text := html.UnescapeString(htmlTag.ReplaceAllString(string(m[1]), " "))
+	return strings.Join(strings.Fields(text), " "), nil
+}
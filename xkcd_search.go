@@ -0,0 +1,64 @@
+package xkcd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/boltdb/bolt"
+)
+
+// Search returns the DocIDs of the comics containing every term of query
+// in order. Terms are tokenized with the rules in use, and the OnSearch
+// hooks are called with the results.
+func Search(query string) ([]int, error) {
+	return SearchContext(context.Background(), query)
+}
+
+// SearchContext is Search, failing with ctx's error if ctx is done while
+// waiting for the database lock or before every posting list is read
+func SearchContext(ctx context.Context, query string) ([]int, error) {
+	terms := uniqueTerms(Tokenize(query))
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+	o := DBOptions
+	o.ReadOnly = true
+	db, err := openDBContext(ctx, IndexPath(), o)
+	if err != nil {
+		return nil, fmt.Errorf("db failed to open:\n%s", err)
+	}
+	defer db.Close()
+
+	var refs []int
+	t := TraceTx("view", "main")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(Bucket("main"))
+		if b == nil {
+			return fmt.Errorf("index not found")
+		}
+		counts := make(map[int]int)
+		for _, term := range terms {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			t.Get()
+			for _, ref := range Bstois(b.Get([]byte(term))) {
+				counts[ref]++
+			}
+		}
+		for ref, n := range counts {
+			if n == len(terms) {
+				refs = append(refs, ref)
+			}
+		}
+		return nil
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		return nil, fmt.Errorf("view op failed: %w", vErr)
+	}
+	sort.Ints(refs)
+	Searched(query, refs)
+	return refs, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// selfTest round-trips sample values through the protobuf and
+// posting-list codecs and reports pass/fail for each ('xkcd selftest')
+func selfTest() error {
+	var pass, fail int
+	check := func(name string, got, want interface{}) {
+		if reflect.DeepEqual(got, want) {
+			fmt.Printf("PASS\t%s\n", name)
+			pass++
+			return
+		}
+		fmt.Printf("FAIL\t%s: got %v, want %v\n", name, got, want)
+		fail++
+	}
+
+	// single DocIDs (Itob/Btoi), stored as 2-byte uint16s up to 65535
+	for _, i := range []int{0, 1, 255, 256, 404, 65534, 65535} {
+		check(fmt.Sprintf("Itob/Btoi %d", i), xkcd.Btoi(xkcd.Itob(i)), i)
+	}
+
+	// posting lists (Istobs/Bstois)
+	lists := [][]int{
+		{1},
+		{1, 2, 3, 404, 2160},
+		{65534, 65535},
+		{0, 404, 65535},
+	}
+	for _, l := range lists {
+		check(fmt.Sprintf("Istobs/Bstois %v", l), xkcd.Bstois(xkcd.Istobs(l)), l)
+	}
+	check("Istobs/Bstois []", len(xkcd.Bstois(xkcd.Istobs(nil))), 0)
+
+	// LogData records (protobuf)
+	records := []xkcd.LogData{
+		{},
+		{Month: "4", Num: 327, Link: "https://xkcd.com/327", Year: "2007",
+			SafeTitle: "Exploits of a Mom", Alt: "Her daughter is named Help I'm trapped in a driver's license factory.",
+			Img: "https://imgs.xkcd.com/comics/exploits_of_a_mom.png", Title: "Exploits of a Mom", Day: "4",
+			Transcript: "[[A woman is talking on the phone.]]\nPhone: Hi, this is your son's school.\n{{Title text: ...}}"},
+		{Num: 1, Title: "Barrel - Part 1", News: "<a href=\"https://store.xkcd.com\">store</a>"},
+		{Num: 2000, Title: "ünïcödé ☃ 🚀", Transcript: "\t\n"},
+	}
+	for _, r := range records {
+		check(fmt.Sprintf("protobuf record %d", r.Num), decodeProto(xkcd.EncodeLogData(r)), r)
+	}
+
+	fmt.Printf("\n%v passed, %v failed\n", pass, fail)
+	if fail > 0 {
+		return fmt.Errorf("selftest failed: current database format cannot round-trip %v sample(s)", fail)
+	}
+	return nil
+}
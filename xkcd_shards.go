@@ -0,0 +1,169 @@
+package xkcd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/boltdb/bolt"
+)
+
+// The year-sharded layout copies the posting lists of the 'main' bucket
+// into one nested bucket per publication year of the 'shards' bucket, so
+// date-filtered queries only read the postings of the years they cover.
+// The layout is enabled while the 'shards' bucket exists, and its shards
+// are only used while its 'built' key is present: InvalidateCache deletes
+// the key whenever the index changes, and RefreshShards rebuilds them.
+
+// BuildShards enables the year-sharded layout and (re)builds its shards
+// from the 'main' and 'data' buckets. It returns the number of shards.
+func BuildShards() (int, error) {
+	db, err := OpenDB(IndexPath())
+	if err != nil {
+		return 0, fmt.Errorf("db failed to open:\n%s", err)
+	}
+	defer db.Close()
+
+	var n int
+	t := TraceTx("update", "shards")
+	uErr := db.Update(func(tx *bolt.Tx) error {
+		data, main := tx.Bucket(Bucket("data")), tx.Bucket(Bucket("main"))
+		if data == nil || main == nil {
+			return fmt.Errorf("index not found - run with -u first")
+		}
+		years := make(map[int]string)
+		err := data.ForEach(func(k, v []byte) error {
+			d, err := decodeLogData(v)
+			if err != nil {
+				return err
+			}
+			t.Get()
+			years[Btoi(k)] = d.Year
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if tx.Bucket(Bucket("shards")) != nil {
+			if err := tx.DeleteBucket(Bucket("shards")); err != nil {
+				return fmt.Errorf("delete 'shards' bucket failed:\n%s", err)
+			}
+		}
+		sb, err := tx.CreateBucket(Bucket("shards"))
+		if err != nil {
+			return fmt.Errorf("create 'shards' bucket failed:\n%s", err)
+		}
+		err = main.ForEach(func(k, v []byte) error {
+			t.Get()
+			split := make(map[string][]int)
+			for _, i := range Bstois(v) {
+				if y := years[i]; y != "" { // undated documents aren't sharded
+					split[y] = append(split[y], i)
+				}
+			}
+			for y, refs := range split {
+				yb, err := sb.CreateBucketIfNotExists([]byte(y))
+				if err != nil {
+					return fmt.Errorf("create shard %q failed:\n%s", y, err)
+				}
+				if err := yb.Put(k, Istobs(refs)); err != nil {
+					return fmt.Errorf("put failed:\n%s", err)
+				}
+				t.Put(k, Istobs(refs))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := sb.Put([]byte("built"), []byte("1")); err != nil {
+			return fmt.Errorf("put failed:\n%s", err)
+		}
+		return sb.ForEach(func(k, v []byte) error {
+			if v == nil { // nested year bucket
+				n++
+			}
+			return nil
+		})
+	})
+	t.Done(uErr)
+	if uErr != nil {
+		return 0, fmt.Errorf("update transaction failed:\n%s", uErr)
+	}
+	return n, nil
+}
+
+// RefreshShards rebuilds the shards if the year-sharded layout is enabled
+func RefreshShards() error {
+	db, err := OpenDB(IndexPath())
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+	var enabled bool
+	db.View(func(tx *bolt.Tx) error {
+		enabled = tx.Bucket(Bucket("shards")) != nil
+		return nil
+	})
+	db.Close()
+	if !enabled {
+		return nil
+	}
+	n, err := BuildShards()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("year shards rebuilt: %v\n", n)
+	return nil
+}
+
+// DropShards disables the year-sharded layout and deletes its shards
+func DropShards() error {
+	db, err := OpenDB(IndexPath())
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+	defer db.Close()
+
+	t := TraceTx("update", "shards")
+	uErr := db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(Bucket("shards")) == nil {
+			return nil
+		}
+		t.Delete()
+		return tx.DeleteBucket(Bucket("shards"))
+	})
+	t.Done(uErr)
+	if uErr != nil {
+		return fmt.Errorf("update transaction failed:\n%s", uErr)
+	}
+	return nil
+}
+
+// invalidateShards marks the shards as out of date with the index
+func invalidateShards(tx *bolt.Tx) error {
+	sb := tx.Bucket(Bucket("shards"))
+	if sb == nil || sb.Get([]byte("built")) == nil {
+		return nil
+	}
+	if err := sb.Delete([]byte("built")); err != nil {
+		return fmt.Errorf("delete failed:\n%s", err)
+	}
+	return nil
+}
+
+// ShardRefs returns the sorted DocIDs of the comics published in years
+// (ex: "2015") that contain term. ok is false when the shards are missing
+// or out of date and the 'main' bucket must be used instead.
+func ShardRefs(tx *bolt.Tx, years []string, term string) (refs []int, ok bool) {
+	sb := tx.Bucket(Bucket("shards"))
+	if sb == nil || sb.Get([]byte("built")) == nil {
+		return nil, false
+	}
+	for _, y := range years {
+		if yb := sb.Bucket([]byte(y)); yb != nil {
+			refs = append(refs, Bstois(yb.Get([]byte(term)))...)
+		}
+	}
+	sort.Ints(refs)
+	return refs, true
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// weightedTerm is a query term and its weight
+type weightedTerm struct {
+	Term   string
+	Weight float64
+}
+
+// similarComics finds the comics most similar to a given comic by running
+// its most distinctive terms as a weighted query ('xkcd similar 327')
+func similarComics(args []string) error {
+	fs := flag.NewFlagSet("similar", flag.ExitOnError)
+	n := fs.Int("n", 10, "number of similar comics to return")
+	k := fs.Int("terms", 15, "number of distinctive terms to query with")
+	pos := parseArgs(fs, args)
+
+	if len(pos) != 1 {
+		return usageErrorf("usage: xkcd similar <num>")
+	}
+	num, err := strconv.Atoi(pos[0])
+	if err != nil {
+		return usageErrorf("invalid comic number: %q", pos[0])
+	}
+	if *n < 1 {
+		return usageErrorf("-n must be at least 1")
+	}
+	if *k < 1 {
+		return usageErrorf("-terms must be at least 1")
+	}
+	if err := checkIndex(); err != nil {
+		return err
+	}
+	docs := returnData([]int{num})
+	if len(docs) == 0 || docs[0].Num == 0 {
+		return fmt.Errorf("comic %v not indexed", num)
+	}
+
+	terms, resultMap, err := distinctiveTerms(docs[0], *k)
+	if err != nil {
+		return fmt.Errorf("failed to get results: %v", err)
+	}
+
+	// score every comic sharing a term by the sum of the shared terms' weights
+	scores := make(map[int]float64)
+	for _, t := range terms {
+		for _, ref := range resultMap[t.Term] {
+			if ref != num {
+				scores[ref] += t.Weight
+			}
+		}
+	}
+	var refs []int
+	for ref := range scores {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if scores[refs[i]] != scores[refs[j]] {
+			return scores[refs[i]] > scores[refs[j]]
+		}
+		return refs[i] < refs[j]
+	})
+	data := filterPeriod(returnData(refs))
+	if len(data) > *n {
+		data = data[:*n]
+	}
+
+	fmt.Printf("comics similar to %v '%s'\nquery terms:", num, docs[0].Title)
+	for _, t := range terms {
+		fmt.Printf(" %s^%.2f", t.Term, t.Weight)
+	}
+	fmt.Print("\n\n")
+	for _, d := range data {
+		fmt.Printf("Num: %d\nTitle: %s\nScore: %.3f\nLink: %s\n\n", d.Num, d.Title, scores[int(d.Num)], d.Link)
+	}
+	return nil
+}
+
+// distinctiveTerms returns the k terms of d with the highest tf * idf,
+// ignoring terms found in no other comic, along with their posting lists
+func distinctiveTerms(d xkcd.LogData, k int) ([]weightedTerm, map[string][]int, error) {
+	tf := termFreqsOf(d)
+	var query []string
+	for t := range tf {
+		query = append(query, t)
+	}
+	resultMap, err := getRefs(query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	n := countDocs()
+	var terms []weightedTerm
+	for t, f := range tf {
+		df := len(resultMap[t])
+		if df < 2 {
+			continue
+		}
+		terms = append(terms, weightedTerm{t, float64(f) * math.Log(float64(n)/float64(df))})
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].Weight != terms[j].Weight {
+			return terms[i].Weight > terms[j].Weight
+		}
+		return terms[i].Term < terms[j].Term
+	})
+	if len(terms) > k {
+		terms = terms[:k]
+	}
+	return terms, resultMap, nil
+}
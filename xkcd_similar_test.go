@@ -0,0 +1,15 @@
+package main
+
+import "testing"
+
+func TestSimilarComicsInvalidCounts(t *testing.T) {
+	for _, args := range [][]string{
+		{"-n", "-1", "327"},
+		{"-n", "0", "327"},
+		{"-terms", "-1", "327"},
+	} {
+		if got := exitCode(similarComics(args)); got != exitUsage {
+			t.Errorf("similar %v: exit code = %v, want %v", args, got, exitUsage)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package xkcd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// maxRuns is the number of update summaries kept in the 'runs' bucket
+const maxRuns = 100
+
+// RunSummary is the outcome of an update
+type RunSummary struct {
+	Started time.Time      `json:"started"`
+	Elapsed time.Duration  `json:"elapsed"`
+	Fetched int            `json:"fetched"` // new comics downloaded and indexed
+	Retried int            `json:"retried"` // pending comics downloaded and indexed
+	Skipped []int          `json:"skipped"` // comic numbers with no comic (ex: 404)
+	Failed  map[int]string `json:"failed"`  // comics that failed to download, with the reason
+	Bytes   int64          `json:"bytes"`   // JSON info downloaded
+	Error   string         `json:"error,omitempty"`
+}
+
+// LastRun is the summary of the last update, or the update in progress
+var LastRun = RunSummary{Failed: make(map[int]string)}
+
+// startRun resets 'LastRun' for a new update
+func startRun() {
+	LastRun = RunSummary{Started: time.Now(), Failed: make(map[int]string)}
+}
+
+// finishRun completes 'LastRun' with the outcome err of the update,
+// prints it and stores it in the 'runs' bucket, stores the update's
+// failures in the 'failures' bucket, and calls the OnUpdateComplete hooks
+func finishRun(err error) {
+	LastRun.Elapsed = time.Since(LastRun.Started)
+	if err != nil {
+		LastRun.Error = err.Error()
+		noteFailure(0, "update", err)
+	}
+	flushFailures()
+	LastRun.Print()
+	if sErr := storeRun(LastRun); sErr != nil {
+		fmt.Fprintf(os.Stderr, "failed to store run summary: %v\n", sErr)
+	}
+	updateCompleted(LastRun)
+}
+
+// Print writes the summary to stdout
+func (s RunSummary) Print() {
+	fmt.Printf("\n--- update summary ---\n")
+	fmt.Printf("fetched: %v\n", s.Fetched)
+	if s.Retried > 0 {
+		fmt.Printf("retried: %v\n", s.Retried)
+	}
+	fmt.Printf("skipped: %v %v\n", len(s.Skipped), s.Skipped)
+	fmt.Printf("failed:  %v\n", len(s.Failed))
+	var nums []int
+	for n := range s.Failed {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+	for _, n := range nums {
+		fmt.Printf("  %v: %s\n", n, s.Failed[n])
+	}
+	fmt.Printf("downloaded: %v bytes\n", s.Bytes)
+	fmt.Printf("elapsed: %v\n", s.Elapsed.Round(time.Millisecond))
+	if s.Error != "" {
+		fmt.Printf("error: %s\n", s.Error)
+	}
+}
+
+// storeRun adds s to the 'runs' bucket, keyed by its start time, and
+// deletes the oldest summaries beyond 'maxRuns'
+func storeRun(s RunSummary) error {
+	v, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("JSON marshalling failed: %s", err)
+	}
+	db, err := OpenDB(IndexPath())
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+	defer db.Close()
+
+	t := TraceTx("update", "runs")
+	uErr := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(Bucket("runs"))
+		if err != nil {
+			return fmt.Errorf("create 'runs' bucket failed:\n%s", err)
+		}
+		k := runKey(s.Started)
+		if err := b.Put(k, v); err != nil {
+			return fmt.Errorf("put failed:\n%s", err)
+		}
+		t.Put(k, v)
+		var keys [][]byte
+		b.ForEach(func(k, _ []byte) error {
+			keys = append(keys, k)
+			return nil
+		})
+		for i := 0; i < len(keys)-maxRuns; i++ { // oldest first
+			if err := b.Delete(keys[i]); err != nil {
+				return fmt.Errorf("delete failed:\n%s", err)
+			}
+			t.Delete()
+		}
+		return nil
+	})
+	t.Done(uErr)
+	if uErr != nil {
+		return fmt.Errorf("update transaction failed:\n%w", uErr)
+	}
+	return nil
+}
+
+// runKeyLayout formats the keys of the 'runs' bucket. Unlike
+// time.RFC3339Nano it keeps trailing zeros, so keys sort by time.
+const runKeyLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// runKey returns the 'runs' bucket key of a run started at start
+func runKey(start time.Time) []byte {
+	return []byte(start.UTC().Format(runKeyLayout))
+}
+
+// Runs returns the stored update summaries, most recent first
+func Runs(tx *bolt.Tx) ([]RunSummary, error) {
+	b := tx.Bucket(Bucket("runs"))
+	if b == nil {
+		return nil, nil
+	}
+	var runs []RunSummary
+	c := b.Cursor()
+	for k, v := c.Last(); k != nil; k, v = c.Prev() {
+		var s RunSummary
+		if err := json.Unmarshal(v, &s); err != nil {
+			return nil, fmt.Errorf("JSON unmarshalling failed: %s", err)
+		}
+		runs = append(runs, s)
+	}
+	return runs, nil
+}
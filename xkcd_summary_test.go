@@ -0,0 +1,23 @@
+package xkcd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRunKeyOrder(t *testing.T) {
+	start := time.Date(2026, 10, 16, 12, 0, 5, 0, time.UTC)
+	times := []time.Time{
+		start,
+		start.Add(100 * time.Millisecond),
+		start.Add(500 * time.Millisecond),
+		start.Add(time.Second),
+	}
+	for i := 1; i < len(times); i++ {
+		prev, k := runKey(times[i-1]), runKey(times[i])
+		if bytes.Compare(prev, k) >= 0 {
+			t.Errorf("runKey(%v) = %s sorts after runKey(%v) = %s", times[i-1], prev, times[i], k)
+		}
+	}
+}
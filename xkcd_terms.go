@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/boltdb/bolt"
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// termFreq is a term and the number of documents containing it
+type termFreq struct {
+	Term string
+	DF   int
+}
+
+// topTerms reports the most frequent terms in the index by document
+// frequency ('xkcd terms --top 50 --field title --csv')
+func topTerms(args []string) error {
+	fs := flag.NewFlagSet("terms", flag.ExitOnError)
+	top := fs.Int("top", 50, "number of terms to report")
+	field := fs.String("field", "", "count terms in a single `field` (num, year, title, alt, transcript)")
+	asCSV := fs.Bool("csv", false, "write results as CSV")
+	fs.Parse(args)
+
+	if err := checkIndex(); err != nil {
+		return err
+	}
+	db, err := openIndex(false)
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+
+	var freqs []termFreq
+	if *field == "" && activePeriod == nil {
+		freqs, err = indexFreqs(db)
+	} else {
+		freqs, err = fieldFreqs(db, *field)
+	}
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(freqs, func(i, j int) bool {
+		if freqs[i].DF != freqs[j].DF {
+			return freqs[i].DF > freqs[j].DF
+		}
+		return freqs[i].Term < freqs[j].Term
+	})
+	if *top > 0 && len(freqs) > *top {
+		freqs = freqs[:*top]
+	}
+
+	if *asCSV {
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"term", "df"})
+		for _, f := range freqs {
+			w.Write([]string{f.Term, strconv.Itoa(f.DF)})
+		}
+		w.Flush()
+		return w.Error()
+	}
+	for i, f := range freqs {
+		fmt.Printf("%4d\t%-20s\t%v\n", i+1, f.Term, f.DF)
+	}
+	return nil
+}
+
+// indexFreqs returns the document frequency of every term in the inverted index
+func indexFreqs(db *bolt.DB) ([]termFreq, error) {
+	var freqs []termFreq
+	t := xkcd.TraceTx("view", "main")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(xkcd.Bucket("main"))
+		if b == nil {
+			return indexErrorf("index not found - run with -u first")
+		}
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			freqs = append(freqs, termFreq{string(k), len(v) / 2}) // 2 bytes per DocID
+			t.Get()
+		}
+		return nil
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		return nil, fmt.Errorf("view op failed: %w", vErr)
+	}
+	return freqs, nil
+}
+
+// fieldFreqs returns the document frequency of every term in a single
+// field of the stored data, or in every field if field is empty
+func fieldFreqs(db *bolt.DB, field string) ([]termFreq, error) {
+	if _, err := fieldText(xkcd.LogData{}, field); field != "" && err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	err := eachComic(db, func(d xkcd.LogData) {
+		if field == "" { // every indexed field
+			for _, term := range xkcd.DocTerms(d) {
+				counts[term]++
+			}
+			return
+		}
+		s, _ := fieldText(d, field)
+		seen := make(map[string]bool)
+		for _, term := range xkcd.Tokenize(s) {
+			if !seen[term] {
+				counts[term]++
+				seen[term] = true
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var freqs []termFreq
+	for k, v := range counts {
+		freqs = append(freqs, termFreq{k, v})
+	}
+	return freqs, nil
+}
+
+// fieldText returns the text of an indexed field of d
+func fieldText(d xkcd.LogData, field string) (string, error) {
+	switch field {
+	case "num":
+		return strconv.Itoa(int(d.Num)), nil
+	case "year":
+		return d.Year, nil
+	case "title":
+		return d.Title, nil
+	case "alt":
+		return d.Alt, nil
+	case "transcript":
+		return d.Transcript, nil
+	default:
+		return "", usageErrorf("unknown field: %q", field)
+	}
+}
+
+// eachComic calls fn with the decoded LogData of every comic in the data
+// index published within 'activePeriod'
+func eachComic(db *bolt.DB, fn func(d xkcd.LogData)) error {
+	t := xkcd.TraceTx("view", "data")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(xkcd.Bucket("data"))
+		if b == nil {
+			return indexErrorf("data index not found - run with -u first")
+		}
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			t.Get()
+			if d := decodeProto(v); activePeriod.contains(d) {
+				fn(d)
+			}
+		}
+		return nil
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		return fmt.Errorf("view op failed: %w", vErr)
+	}
+	return nil
+}
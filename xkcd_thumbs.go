@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // register decoders for comic image formats
+	_ "image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// thumbDir is the directory of 'imageCacheDir' thumbnails are cached in
+var thumbDir = filepath.Join(imageCacheDir, "thumbs")
+
+// thumbWidth is the width in pixels thumbnails are generated at
+var thumbWidth = 160
+
+// thumbFile returns the path of comic num's cached thumbnail
+func thumbFile(num int) string {
+	return filepath.Join(thumbDir, strconv.Itoa(num)+".png")
+}
+
+// generateThumbs creates a thumbnail for each cached image without one
+// ('xkcd images thumbs -width 160')
+func generateThumbs(args []string) error {
+	fs := flag.NewFlagSet("images thumbs", flag.ExitOnError)
+	width := fs.Int("width", thumbWidth, "thumbnail width in pixels")
+	force := fs.Bool("force", false, "regenerate existing thumbnails")
+	fs.Parse(args)
+	if *width < 1 {
+		return usageErrorf("-width must be at least 1")
+	}
+	thumbWidth = *width
+
+	files, err := ioutil.ReadDir(imageCacheDir)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("image cache is empty - run 'xkcd images verify' first")
+	}
+	if err != nil {
+		return fmt.Errorf("image cache read failed: %v", err)
+	}
+	var made, skipped, failed int
+	for _, fi := range files {
+		if fi.IsDir() {
+			continue
+		}
+		num, err := strconv.Atoi(strings.SplitN(fi.Name(), "-", 2)[0])
+		if err != nil {
+			continue // not a comic image
+		}
+		if _, err := os.Stat(thumbFile(num)); err == nil && !*force {
+			skipped++
+			continue
+		}
+		if err := makeThumb(num, filepath.Join(imageCacheDir, fi.Name())); err != nil {
+			failed++
+			fmt.Printf("thumbnail failed: %v (%v)\n", num, err)
+			continue
+		}
+		made++
+	}
+	fmt.Printf("thumbnails created: %v, existing: %v, failed: %v\n", made, skipped, failed)
+	return nil
+}
+
+// makeThumb writes a 'thumbWidth' wide PNG thumbnail of the image at src
+// for comic num
+func makeThumb(num int, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return fmt.Errorf("image decode failed: %v", err)
+	}
+
+	if err := os.MkdirAll(thumbDir, 0766); err != nil {
+		return fmt.Errorf("create thumbnail dir failed: %v", err)
+	}
+	out, err := os.Create(thumbFile(num))
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(out, downscale(img, thumbWidth)); err != nil {
+		out.Close()
+		return fmt.Errorf("png encode failed: %v", err)
+	}
+	return out.Close()
+}
+
+// downscale resizes img to width pixels wide, keeping its aspect ratio,
+// by averaging the source pixels covered by each thumbnail pixel.
+// Images narrower than width are returned unchanged.
+func downscale(img image.Image, width int) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= width {
+		return img
+	}
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+	thumb := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := b.Min.Y+y*b.Dy()/height, b.Min.Y+(y+1)*b.Dy()/height
+		for x := 0; x < width; x++ {
+			x0, x1 := b.Min.X+x*b.Dx()/width, b.Min.X+(x+1)*b.Dx()/width
+			var r, g, bl, a, n uint64 // uint32 sums overflow for large cells
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			if n == 0 {
+				continue
+			}
+			thumb.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(bl / n), uint16(a / n)})
+		}
+	}
+	return thumb
+}
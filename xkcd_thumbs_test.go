@@ -0,0 +1,47 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestDownscale(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 2; y++ {
+			if x < 2 {
+				img.Set(x, y, color.RGBA{255, 255, 255, 255})
+			} else {
+				img.Set(x, y, color.RGBA{0, 0, 0, 255})
+			}
+		}
+	}
+	thumb := downscale(img, 2)
+	if b := thumb.Bounds(); b.Dx() != 2 || b.Dy() != 1 {
+		t.Fatalf("bounds = %v, want 2x1", b)
+	}
+	if got := color.RGBAModel.Convert(thumb.At(0, 0)); got != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("left pixel = %v, want white", got)
+	}
+	if got := color.RGBAModel.Convert(thumb.At(1, 0)); got != (color.RGBA{0, 0, 0, 255}) {
+		t.Errorf("right pixel = %v, want black", got)
+	}
+
+	narrow := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	if downscale(narrow, 20) != image.Image(narrow) {
+		t.Error("image narrower than width was resized")
+	}
+}
+
+// a thumbnail pixel covering more than 65536 source pixels overflowed
+// uint32 sums
+func TestDownscaleLargeCell(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 300, 300))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	if got := color.RGBAModel.Convert(downscale(img, 1).At(0, 0)); got != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("pixel = %v, want white", got)
+	}
+}
@@ -0,0 +1,99 @@
+package xkcd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/boltdb/bolt"
+)
+
+// NormalizeTitle returns the key a comic title is stored under in the
+// 'title' bucket: its terms joined by single spaces
+func NormalizeTitle(title string) string {
+	return strings.Join(Tokenize(title), " ")
+}
+
+// TitleNum returns the DocID of the comic whose normalized title equals
+// title, the lowest if several share it, and false if there is none or
+// the 'title' bucket hasn't been built
+func TitleNum(tx *bolt.Tx, title string) (int, bool) {
+	b := tx.Bucket(Bucket("title"))
+	key := NormalizeTitle(title)
+	if b == nil || key == "" {
+		return 0, false
+	}
+	refs := Bstois(b.Get([]byte(key)))
+	if len(refs) == 0 {
+		return 0, false
+	}
+	num := refs[0]
+	for _, r := range refs[1:] {
+		if r < num {
+			num = r
+		}
+	}
+	return num, true
+}
+
+// titleBucket returns the 'title' bucket of normalized titles mapped to
+// DocIDs. On first use it is created and filled from the 'data' bucket.
+func titleBucket(tx *bolt.Tx, t *TxTrace) (*bolt.Bucket, error) {
+	if b := tx.Bucket(Bucket("title")); b != nil {
+		return b, nil
+	}
+	b, err := tx.CreateBucket(Bucket("title"))
+	if err != nil {
+		return nil, fmt.Errorf("create 'title' bucket failed:\n%s", err)
+	}
+	data := tx.Bucket(Bucket("data"))
+	if data == nil {
+		return b, nil
+	}
+	c := data.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		d, err := decodeLogData(v)
+		if err != nil {
+			return nil, err
+		}
+		t.Get()
+		if err := putTitle(b, d.Title, Btoi(k), t); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// putTitle adds DocID i to the list stored under title
+func putTitle(b *bolt.Bucket, title string, i int, t *TxTrace) error {
+	k := []byte(NormalizeTitle(title))
+	if len(k) == 0 {
+		return nil
+	}
+	refs := insertRef(Bstois(b.Get(k)), i)
+	if err := b.Put(k, Istobs(refs)); err != nil {
+		return fmt.Errorf("put failed:\n%s", err)
+	}
+	t.Put(k, Istobs(refs))
+	return nil
+}
+
+// deleteTitle removes DocID i from the list stored under title
+func deleteTitle(b *bolt.Bucket, title string, i int, t *TxTrace) error {
+	k := []byte(NormalizeTitle(title))
+	if len(k) == 0 {
+		return nil
+	}
+	refs := removeRef(Bstois(b.Get(k)), i)
+	var err error
+	if len(refs) == 0 {
+		err = b.Delete(k)
+		t.Delete()
+	} else {
+		err = b.Put(k, Istobs(refs))
+		t.Put(k, Istobs(refs))
+	}
+	if err != nil {
+		return fmt.Errorf("put failed:\n%s", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// titleSearch matches queries against comic titles only
+var titleSearch bool
+
+// titleRefs returns the DocIDs of comics whose normalized title equals
+// text, followed by those whose title starts with it, each in DocID order
+func titleRefs(text string) ([]int, error) {
+	key := []byte(xkcd.NormalizeTitle(text))
+	if len(key) == 0 {
+		return nil, nil
+	}
+	db, err := openIndex(false)
+	if err != nil {
+		return nil, fmt.Errorf("db failed to open:\n%s", err)
+	}
+
+	var exact, prefix []int
+	t := xkcd.TraceTx("view", "title")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(xkcd.Bucket("title"))
+		if b == nil {
+			return indexErrorf("title index not found - run with -u first")
+		}
+		c := b.Cursor()
+		for k, v := c.Seek(key); k != nil && bytes.HasPrefix(k, key); k, v = c.Next() {
+			t.Get()
+			if bytes.Equal(k, key) {
+				exact = append(exact, xkcd.Bstois(v)...)
+			} else {
+				prefix = append(prefix, xkcd.Bstois(v)...)
+			}
+		}
+		return nil
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		return nil, fmt.Errorf("view op failed: %w", vErr)
+	}
+	sort.Ints(exact)
+	sort.Ints(prefix)
+	return append(exact, prefix...), nil
+}
+
+// titleLookup prints the comic whose title exactly matches the
+// arguments, read from the 'title' bucket without running a token search
+// ('xkcd title "Exploits of a Mom"')
+func titleLookup(args []string) error {
+	fs := flag.NewFlagSet("title", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print record as JSON")
+	pos := parseArgs(fs, args)
+	title := strings.Join(pos, " ")
+	if xkcd.NormalizeTitle(title) == "" {
+		return usageErrorf("usage: xkcd title [--json] <title>")
+	}
+
+	if err := checkIndex(); err != nil {
+		return err
+	}
+	db, err := openIndex(false)
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+	var num int
+	found := false
+	t := xkcd.TraceTx("view", "title")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(xkcd.Bucket("title")) == nil {
+			return indexErrorf("title index not found - run with -u first")
+		}
+		num, found = xkcd.TitleNum(tx, title)
+		t.Get()
+		return nil
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		return vErr
+	}
+	if !found {
+		return errNoResults
+	}
+	return showComic(num, *asJSON)
+}
@@ -0,0 +1,132 @@
+package xkcd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+
+	"github.com/boltdb/bolt"
+)
+
+// Rule replaces each match of the regular expression Pattern with With
+type Rule struct {
+	Pattern string `json:"pattern"`
+	With    string `json:"with"`
+}
+
+// TokenRules are the character-filtering rules text is indexed with.
+// With Transliterate set, non-ASCII characters are romanized first. The
+// Replace rules are then applied in order, the text is lowercased, and
+// each match of Split is replaced by a space to separate the terms.
+type TokenRules struct {
+	Transliterate bool   `json:"transliterate,omitempty"`
+	Replace       []Rule `json:"replace"`
+	Split         string `json:"split"`
+}
+
+// DefaultTokenRules are the rules of indexes built without a config file
+var DefaultTokenRules = TokenRules{
+	Replace: []Rule{
+		{"\n", "    "}, // replace terms joined by \n with 4 spaces (ex: "boy\nThey" -> "boy", "They")
+		{"'", ""},      // don't split contractions (ex: 'can't' !-> "can", "t")
+		{",", ""},      // don't split numerical values > 999 (ex: 20,000 !-> 20 000)
+	},
+	Split: "[^a-zA-Z0-9]+", // removes all non alpha-numeric characters
+}
+
+// tokenRules are the rules in use and their compiled patterns
+var (
+	tokenRules  = DefaultTokenRules
+	replaceRegs []*regexp.Regexp
+	splitReg    *regexp.Regexp
+)
+
+// errRulesDiff is returned when adding terms to an index built with
+// different rules, as its postings would no longer match one analyzer
+var errRulesDiff = errors.New("index was built with different tokenization rules - rebuild it or restore the rules it records")
+
+func init() {
+	if err := SetTokenRules(DefaultTokenRules); err != nil {
+		panic(err)
+	}
+}
+
+// SetTokenRules sets the rules text is indexed with
+func SetTokenRules(r TokenRules) error {
+	var regs []*regexp.Regexp
+	for _, rule := range r.Replace {
+		reg, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid tokenization rule %q: %v", rule.Pattern, err)
+		}
+		regs = append(regs, reg)
+	}
+	if r.Split == "" {
+		return fmt.Errorf("split pattern is empty")
+	}
+	split, err := regexp.Compile(r.Split)
+	if err != nil {
+		return fmt.Errorf("invalid split pattern %q: %v", r.Split, err)
+	}
+	tokenRules, replaceRegs, splitReg = r, regs, split
+	return nil
+}
+
+// IndexTokenRules returns the rules recorded in the 'meta' bucket. ok is
+// false for indexes built before the rules were recorded.
+func IndexTokenRules(tx *bolt.Tx) (r TokenRules, ok bool) {
+	b := tx.Bucket(Bucket("meta"))
+	if b == nil {
+		return r, false
+	}
+	v := b.Get([]byte("tokenize"))
+	if v == nil || json.Unmarshal(v, &r) != nil {
+		return r, false
+	}
+	return r, true
+}
+
+// TokenRulesMatch reports whether the index was built with the rules in
+// use; indexes that don't record their rules used DefaultTokenRules
+func TokenRulesMatch(tx *bolt.Tx) bool {
+	r, ok := IndexTokenRules(tx)
+	if !ok {
+		if tx.Bucket(Bucket("main")) == nil {
+			return true // empty index
+		}
+		r = DefaultTokenRules
+	}
+	return reflect.DeepEqual(r, tokenRules)
+}
+
+// recordTokenRules records the rules in use in the 'meta' bucket, or
+// returns an error if the index was built with different rules. It must
+// be called in every transaction that adds terms to the 'main' bucket.
+func recordTokenRules(tx *bolt.Tx, t *TxTrace) error {
+	if !TokenRulesMatch(tx) {
+		return errRulesDiff
+	}
+	if b := tx.Bucket(Bucket("meta")); b != nil && b.Get([]byte("tokenize")) != nil {
+		return nil
+	}
+	return putTokenRules(tx, t)
+}
+
+// putTokenRules records the rules in use in the 'meta' bucket
+func putTokenRules(tx *bolt.Tx, t *TxTrace) error {
+	b, err := tx.CreateBucketIfNotExists(Bucket("meta"))
+	if err != nil {
+		return fmt.Errorf("create 'meta' bucket failed:\n%s", err)
+	}
+	v, err := json.Marshal(tokenRules)
+	if err != nil {
+		return fmt.Errorf("JSON marshalling failed: %s", err)
+	}
+	if err := b.Put([]byte("tokenize"), v); err != nil {
+		return fmt.Errorf("put failed:\n%s", err)
+	}
+	t.Put([]byte("tokenize"), v)
+	return nil
+}
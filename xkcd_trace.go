@@ -0,0 +1,51 @@
+package xkcd
+
+import (
+	"log"
+	"time"
+)
+
+// Debug enables trace logging of each bolt transaction
+var Debug bool
+
+// TxTrace counts the operations and bytes written by a single bolt
+// transaction and logs them with the transaction's duration when 'Debug' is set.
+type TxTrace struct {
+	Op      string // "view" or "update"
+	Bucket  string
+	Gets    int
+	Puts    int
+	Deletes int
+	Bytes   int // key + value bytes written
+	start   time.Time
+}
+
+// TraceTx starts tracing a transaction of type op on bucket
+func TraceTx(op, bucket string) *TxTrace {
+	return &TxTrace{Op: op, Bucket: bucket, start: time.Now()}
+}
+
+// Get records a read
+func (t *TxTrace) Get() {
+	t.Gets++
+}
+
+// Put records a write of k/v
+func (t *TxTrace) Put(k, v []byte) {
+	t.Puts++
+	t.Bytes += len(k) + len(v)
+}
+
+// Delete records a delete of k
+func (t *TxTrace) Delete() {
+	t.Deletes++
+}
+
+// Done logs the transaction once it has been committed or rolled back
+func (t *TxTrace) Done(err error) {
+	if !Debug {
+		return
+	}
+	log.Printf("tx %s bucket=%q gets=%d puts=%d deletes=%d bytes=%d duration=%v err=%v",
+		t.Op, t.Bucket, t.Gets, t.Puts, t.Deletes, t.Bytes, time.Since(t.start), err)
+}
@@ -0,0 +1,182 @@
+package xkcd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/boltdb/bolt"
+)
+
+// Translator translates indexed text into another language
+type Translator interface {
+	Translate(text, lang string) (string, error)
+}
+
+// CommandTranslator translates text with a shell command that reads the
+// text on stdin, with the target language in $XKCD_LANG, and writes the
+// translation to stdout (ex: 'trans -b :$XKCD_LANG')
+type CommandTranslator struct {
+	Command string
+}
+
+// Translate runs the command for text and lang
+func (c CommandTranslator) Translate(text, lang string) (string, error) {
+	cmd := exec.Command("sh", "-c", c.Command)
+	cmd.Env = append(os.Environ(), "XKCD_LANG="+lang)
+	cmd.Stdin = strings.NewReader(text)
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("translate command failed: %v", err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// Translation is a comic's title and alt text in another language
+type Translation struct {
+	Lang  string `json:"lang"`
+	Title string `json:"title"`
+	Alt   string `json:"alt"`
+}
+
+// translationKey returns the key of comic i's translation into lang
+func translationKey(i int, lang string) []byte {
+	return append(Itob(i), []byte(lang)...)
+}
+
+// Translate stores the title and alt text of each comic in nums (every
+// indexed comic when nums is empty) translated into each of langs with
+// tr in the 'translations' bucket, and indexes the translated terms so
+// the comics can be searched in those languages. Comics already
+// translated into a language are skipped. It returns the number of
+// translations added.
+func Translate(tr Translator, langs []string, nums []int) (int, error) {
+	db, err := OpenDB(IndexPath())
+	if err != nil {
+		return 0, fmt.Errorf("db failed to open:\n%s", err)
+	}
+	defer db.Close()
+
+	// find the comics missing a translation
+	type job struct {
+		Data LogData
+		Lang string
+	}
+	var jobs []job
+	t := TraceTx("view", "translations")
+	vErr := db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(Bucket("data"))
+		if data == nil {
+			return fmt.Errorf("index not found - run with -u first")
+		}
+		if len(nums) == 0 {
+			data.ForEach(func(k, v []byte) error {
+				nums = append(nums, Btoi(k))
+				return nil
+			})
+		}
+		tb := tx.Bucket(Bucket("translations"))
+		for _, num := range nums {
+			pb := data.Get(Itob(num))
+			t.Get()
+			if pb == nil {
+				continue
+			}
+			d, err := decodeLogData(pb)
+			if err != nil {
+				return err
+			}
+			for _, lang := range langs {
+				if tb == nil || tb.Get(translationKey(num, lang)) == nil {
+					jobs = append(jobs, job{d, lang})
+				}
+			}
+		}
+		return nil
+	})
+	t.Done(vErr)
+	if vErr != nil {
+		return 0, fmt.Errorf("view op failed: %s", vErr)
+	}
+
+	added := 0
+	for _, j := range jobs {
+		tl := Translation{Lang: j.Lang}
+		if tl.Title, err = tr.Translate(j.Data.Title, j.Lang); err != nil {
+			return added, err
+		}
+		if tl.Alt, err = tr.Translate(j.Data.Alt, j.Lang); err != nil {
+			return added, err
+		}
+		if err := storeTranslation(db, int(j.Data.Num), tl); err != nil {
+			return added, err
+		}
+		fmt.Printf("file translated: %v (%s)\n", j.Data.Num, j.Lang)
+		added++
+	}
+	return added, nil
+}
+
+// storeTranslation stores translation tl of comic i and adds i to the
+// posting list of each translated term
+func storeTranslation(db *bolt.DB, i int, tl Translation) error {
+	v, err := json.Marshal(tl)
+	if err != nil {
+		return fmt.Errorf("JSON marshalling failed: %s", err)
+	}
+	t := TraceTx("update", "translations")
+	uErr := db.Update(func(tx *bolt.Tx) error {
+		if err := InvalidateCache(tx); err != nil {
+			return err
+		}
+		if err := recordTokenRules(tx, t); err != nil {
+			return err
+		}
+		b, err := tx.CreateBucketIfNotExists(Bucket("translations"))
+		if err != nil {
+			return fmt.Errorf("create 'translations' bucket failed:\n%s", err)
+		}
+		k := translationKey(i, tl.Lang)
+		if err := b.Put(k, v); err != nil {
+			return fmt.Errorf("put failed:\n%s", err)
+		}
+		t.Put(k, v)
+
+		main := tx.Bucket(Bucket("main"))
+		for term := range termSet(formatText(tl.Title + " " + tl.Alt)) {
+			refs := insertRef(Bstois(main.Get([]byte(term))), i)
+			if err := main.Put([]byte(term), Istobs(refs)); err != nil {
+				return fmt.Errorf("put failed:\n%s", err)
+			}
+			t.Put([]byte(term), Istobs(refs))
+		}
+		return nil
+	})
+	t.Done(uErr)
+	if uErr != nil {
+		return fmt.Errorf("update transaction failed:\n%s", uErr)
+	}
+	return nil
+}
+
+// Translations returns the stored translations of comic i
+func Translations(tx *bolt.Tx, i int) []Translation {
+	b := tx.Bucket(Bucket("translations"))
+	if b == nil {
+		return nil
+	}
+	var tls []Translation
+	prefix := Itob(i)
+	c := b.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		var tl Translation
+		if json.Unmarshal(v, &tl) == nil {
+			tls = append(tls, tl)
+		}
+	}
+	return tls
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// translator translates new comics on update when set with -translate
+var translator xkcd.Translator
+
+// translateLangs are the languages comics are translated into
+var translateLangs []string
+
+// translateComics translates the titles and alt text of the given
+// comics, or of every comic not yet translated, into each language
+// ('xkcd -translate "trans -b :$XKCD_LANG" -langs es,de translate 1000-1100')
+func translateComics(args []string) error {
+	fs := flag.NewFlagSet("translate", flag.ExitOnError)
+	fs.Parse(args)
+	if translator == nil || len(translateLangs) == 0 {
+		return usageErrorf("usage: xkcd -translate <command> -langs <lang,...> translate [num|from-to...]")
+	}
+	nums, err := parseNums(fs.Args())
+	if err != nil {
+		return err
+	}
+	if err := checkIndex(); err != nil {
+		return err
+	}
+	closeIndex() // xkcd.Translate opens the database itself
+	n, err := xkcd.Translate(translator, translateLangs, nums)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("translations added: %v\n", n)
+	return nil
+}
+
+// parseLangs parses a comma-separated list of language codes
+func parseLangs(s string) []string {
+	var langs []string
+	for _, l := range strings.Split(s, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			langs = append(langs, l)
+		}
+	}
+	return langs
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// termTrend prints how many comics contain a term in each publication
+// year as an ASCII chart or CSV ('xkcd trend -csv bitcoin')
+func termTrend(args []string) error {
+	fs := flag.NewFlagSet("trend", flag.ExitOnError)
+	asCSV := fs.Bool("csv", false, "write results as CSV")
+	width := fs.Int("width", 50, "width of the longest bar")
+
+	query := xkcd.Tokenize(strings.Join(parseArgs(fs, args), " "))
+	if len(query) == 0 {
+		return usageErrorf("usage: xkcd trend <term>")
+	}
+	if *width < 1 {
+		return usageErrorf("-width must be at least 1")
+	}
+	if err := checkIndex(); err != nil {
+		return err
+	}
+	refs, err := findCommon(query)
+	if err != nil {
+		return fmt.Errorf("failed to get results: %v", err)
+	}
+	matches := make(map[int]bool)
+	for _, v := range refs {
+		matches[v] = true
+	}
+
+	db, err := openIndex(false)
+	if err != nil {
+		return fmt.Errorf("db failed to open:\n%s", err)
+	}
+
+	// count matching and total comics per year
+	hits, totals := make(map[string]int), make(map[string]int)
+	err = eachComic(db, func(d xkcd.LogData) {
+		totals[d.Year]++
+		if matches[int(d.Num)] {
+			hits[d.Year]++
+		}
+	})
+	if err != nil {
+		return err
+	}
+	var years []string
+	max := 0
+	for y := range totals {
+		years = append(years, y)
+		if hits[y] > max {
+			max = hits[y]
+		}
+	}
+	sort.Strings(years)
+
+	if *asCSV {
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"year", "comics", "matches"})
+		for _, y := range years {
+			w.Write([]string{y, strconv.Itoa(totals[y]), strconv.Itoa(hits[y])})
+		}
+		w.Flush()
+		return w.Error()
+	}
+	fmt.Printf("comics containing '%s' per year\n\n", strings.Join(query, " "))
+	for _, y := range years {
+		bar := 0
+		if max > 0 {
+			bar = hits[y] * *width / max
+		}
+		fmt.Printf("%s\t%4d/%-4d\t%s\n", y, hits[y], totals[y], strings.Repeat("#", bar))
+	}
+	return nil
+}
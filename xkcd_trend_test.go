@@ -0,0 +1,9 @@
+package main
+
+import "testing"
+
+func TestTermTrendInvalidWidth(t *testing.T) {
+	if got := exitCode(termTrend([]string{"-width", "-1", "bitcoin"})); got != exitUsage {
+		t.Errorf("exit code = %v, want %v", got, exitUsage)
+	}
+}
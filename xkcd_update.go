@@ -0,0 +1,25 @@
+package xkcd
+
+import "sort"
+
+// Update indexes the comics published since the last update and returns
+// them in DocID order. Unlike GetInfo it may be called repeatedly by a
+// long-running process.
+func Update() ([]LogData, error) {
+	GetIndex()
+	defer resetMaps()
+	if err := GetInfo(); err != nil {
+		return nil, err
+	}
+	if len(DataMap) > 0 {
+		if err := RefreshShards(); err != nil {
+			return nil, err
+		}
+	}
+	var added []LogData
+	for _, d := range DataMap {
+		added = append(added, d)
+	}
+	sort.Slice(added, func(i, j int) bool { return added[i].Num < added[j].Num })
+	return added, nil
+}
@@ -0,0 +1,50 @@
+package xkcd
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// urlPattern matches absolute and scheme-relative URLs
+var urlPattern = regexp.MustCompile(`(?i)(?:https?:)?//[a-z0-9.-]+\.[a-z]{2,}[^\s"'<>]*`)
+
+// newsText returns the text of the HTML in a comic's 'News' field, with
+// its tags removed by 'htmlTag', followed by the URLs it links to, so
+// both are indexed
+func newsText(news string) string {
+	if news == "" {
+		return ""
+	}
+	urls := urlPattern.FindAllString(news, -1)
+	return strings.Join(append([]string{htmlTag.ReplaceAllString(news, " ")}, urls...), " ")
+}
+
+// urlTerms returns the hostname terms of the URLs in the 'News' and
+// 'Link' fields of m, prefixed by their field (ex: 'news:store.xkcd.com',
+// 'link:xkcd.com'), so announcements and related pages can be searched
+// by site. A leading 'www.' is dropped.
+func urlTerms(m *MapData) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	add := func(field, s string) {
+		for _, raw := range urlPattern.FindAllString(s, -1) {
+			if strings.HasPrefix(raw, "//") {
+				raw = "http:" + raw
+			}
+			u, err := url.Parse(raw)
+			if err != nil || u.Hostname() == "" {
+				continue
+			}
+			host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+			term := field + ":" + host
+			if !seen[term] {
+				seen[term] = true
+				terms = append(terms, term)
+			}
+		}
+	}
+	add("news", m.News)
+	add("link", m.Link)
+	return terms
+}
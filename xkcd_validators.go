@@ -0,0 +1,78 @@
+package xkcd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/boltdb/bolt"
+)
+
+// errNotModified is returned by conditional requests for comics whose
+// info hasn't changed since it was downloaded
+var errNotModified = errors.New("not modified")
+
+// validator is the cache validator xkcd.com sent with a comic's info,
+// sent back when refetching it so unchanged info isn't downloaded again
+type validator struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// validatorOf returns the validator of resp
+func validatorOf(resp *http.Response) validator {
+	return validator{resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")}
+}
+
+// header returns the headers making a request conditional on v, or nil
+// if v is empty
+func (v validator) header() http.Header {
+	if v == (validator{}) {
+		return nil
+	}
+	h := make(http.Header)
+	if v.ETag != "" {
+		h.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		h.Set("If-Modified-Since", v.LastModified)
+	}
+	return h
+}
+
+// putValidator records the validator of comic i's info in the
+// 'validators' bucket, deleting it if v is empty
+func putValidator(tx *bolt.Tx, i int, v validator, t *TxTrace) error {
+	b, err := tx.CreateBucketIfNotExists(Bucket("validators"))
+	if err != nil {
+		return fmt.Errorf("create 'validators' bucket failed:\n%s", err)
+	}
+	if v == (validator{}) {
+		t.Delete()
+		return b.Delete(Itob(i))
+	}
+	enc, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("JSON marshalling failed: %s", err)
+	}
+	if err := b.Put(Itob(i), enc); err != nil {
+		return fmt.Errorf("put failed:\n%s", err)
+	}
+	t.Put(Itob(i), enc)
+	return nil
+}
+
+// storedValidator returns the validator of stored comic i's info, or the
+// empty validator if comic i isn't stored or none was recorded
+func storedValidator(tx *bolt.Tx, i int) validator {
+	var v validator
+	data, b := tx.Bucket(Bucket("data")), tx.Bucket(Bucket("validators"))
+	if data == nil || b == nil || data.Get(Itob(i)) == nil {
+		return v
+	}
+	if enc := b.Get(Itob(i)); enc != nil {
+		json.Unmarshal(enc, &v)
+	}
+	return v
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"gpl/ch4/exercises/e4.12/xkcd"
+)
+
+// watchComics stays running and indexes new comics every interval,
+// printing each one as it arrives and firing the saved alerts it
+// matches, and optionally reconciles the index with the archive
+// ('xkcd watch --interval 1h --reconcile 168h')
+func watchComics(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	interval := fs.Duration("interval", time.Hour, "time between checks for new comics")
+	notify := fs.String("notify", "", "shell `command` run for each new comic with XKCD_NUM, XKCD_TITLE and XKCD_LINK set")
+	reconcile := fs.Duration("reconcile", 0, "time between reconciliations of titles and dates with the archive (0 disables)")
+	fs.Parse(args)
+	explicit := false
+	fs.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "interval" })
+	if *interval <= 0 {
+		return usageErrorf("-interval must be positive")
+	}
+	wait := watchInterval(*interval, explicit)
+
+	reloads := configReloads()
+	var reconciled time.Time
+	for {
+		if *reconcile > 0 && time.Since(reconciled) >= *reconcile {
+			// queued discrepancies are refetched by the update below
+			if err := runReconcile(false); err != nil {
+				fmt.Fprintf(os.Stderr, "%s %v\n", time.Now().Format(time.RFC3339), err)
+			}
+			reconciled = time.Now()
+		}
+		added, err := xkcd.Update()
+		if err != nil {
+			// keep watching through network outages
+			fmt.Fprintf(os.Stderr, "%s update failed: %v\n", time.Now().Format(time.RFC3339), err)
+		}
+		for _, d := range added {
+			fmt.Printf("%s new comic: %d %s - %s\n", time.Now().Format(time.RFC3339), d.Num, d.Title, d.Link)
+			if *notify != "" {
+				if err := notifyComic(*notify, d); err != nil {
+					fmt.Fprintf(os.Stderr, "notify failed: %v\n", err)
+				}
+			}
+		}
+		if err := checkAlerts(added); err != nil {
+			fmt.Fprintf(os.Stderr, "alerts failed: %v\n", err)
+		}
+
+		// apply config changes while waiting for the next check
+		checked := time.Now()
+		for timer := time.NewTimer(wait); ; {
+			select {
+			case c := <-reloads:
+				if !reloadConfig(c) {
+					continue
+				}
+				if d := watchInterval(*interval, explicit); d != wait {
+					wait = d
+					if !timer.Stop() {
+						<-timer.C
+					}
+					timer.Reset(time.Until(checked.Add(wait)))
+				}
+				continue
+			case <-timer.C:
+			}
+			break
+		}
+	}
+}
+
+// watchInterval returns the time between checks: the -interval flag when
+// given, or the interval in the active config, or the flag's default
+func watchInterval(flagInterval time.Duration, explicit bool) time.Duration {
+	if !explicit && activeConfig.Interval != "" {
+		if d, err := time.ParseDuration(activeConfig.Interval); err == nil && d > 0 {
+			return d
+		}
+	}
+	return flagInterval
+}
+
+// notifyComic runs the shell command cmd with comic d in its environment
+func notifyComic(cmd string, d xkcd.LogData) error {
+	c := exec.Command("sh", "-c", cmd)
+	c.Env = append(os.Environ(),
+		"XKCD_NUM="+strconv.Itoa(int(d.Num)),
+		"XKCD_TITLE="+d.Title,
+		"XKCD_LINK="+d.Link,
+	)
+	c.Stdout, c.Stderr = os.Stdout, os.Stderr
+	return c.Run()
+}